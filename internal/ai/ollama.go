@@ -2,7 +2,9 @@ package ai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -56,6 +58,43 @@ func Ollama(program string, sh shell.Shell, opts OllamaOptions) (*model.Command,
 	return parseAIResponse(program, result.Response), nil
 }
 
+// ErrUnreachable is returned by PingOllama when nothing answers.
+var ErrUnreachable = errors.New("is not reachable")
+
+// PingOllama checks that Ollama answers and has the model.
+func PingOllama(ctx context.Context, opts OllamaOptions) error {
+	if opts.BaseURL == "" {
+		opts.BaseURL = defaultOllamaURL
+	}
+	if opts.Model == "" {
+		opts.Model = defaultOllamaModel
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", opts.BaseURL+"/api/tags", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ollama %w at %s", ErrUnreachable, opts.BaseURL)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("could not parse ollama response: %w", err)
+	}
+	for _, m := range result.Models {
+		if m.Name == opts.Model || strings.HasPrefix(m.Name, opts.Model+":") {
+			return nil
+		}
+	}
+	return fmt.Errorf("ollama has no model %q (run: ollama pull %s)", opts.Model, opts.Model)
+}
+
 func buildPrompt(program string, sh shell.Shell) string {
 	return fmt.Sprintf(`You are a shell completion expert. Generate a list of CLI flags and subcommands for the program "%s".
 
@@ -78,9 +117,13 @@ Now generate completions for: %s
 Target shell: %s`, program, program, sh)
 }
 
+// aiConfidence is the confidence given to AI-generated flags and subcommands:
+// they are plausible but unverified.
+const aiConfidence = 0.5
+
 // parseAIResponse parses the structured AI output into a Command tree.
 func parseAIResponse(program, response string) *model.Command {
-	cmd := &model.Command{Name: program}
+	cmd := &model.Command{Name: program, Source: model.SourceAI, Confidence: aiConfidence}
 
 	for line := range strings.SplitSeq(response, "\n") {
 		line = strings.TrimSpace(line)
@@ -93,11 +136,17 @@ func parseAIResponse(program, response string) *model.Command {
 				Long:        parts[2],
 				Description: parts[3],
 				TakesArg:    parts[4] == "true",
+				Source:      model.SourceAI,
+				Line:        line,
+				Confidence:  aiConfidence,
 			})
 		case strings.HasPrefix(line, "SUBCOMMAND|") && len(parts) == 3:
 			cmd.Subcommands = append(cmd.Subcommands, &model.Command{
 				Name:        parts[1],
 				Description: parts[2],
+				Source:      model.SourceAI,
+				Line:        line,
+				Confidence:  aiConfidence,
 			})
 		}
 	}
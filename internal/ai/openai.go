@@ -2,6 +2,7 @@ package ai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,6 +14,7 @@ import (
 )
 
 const openAIURL = "https://api.openai.com/v1/chat/completions"
+const openAIModelsURL = "https://api.openai.com/v1/models/"
 const defaultOpenAIModel = "gpt-4o-mini"
 
 // OpenAIOptions configures the OpenAI API backend.
@@ -77,3 +79,37 @@ func OpenAI(program string, sh shell.Shell, opts OpenAIOptions) (*model.Command,
 
 	return parseAIResponse(program, result.Choices[0].Message.Content), nil
 }
+
+// PingOpenAI checks that the API key is accepted and the model exists.
+func PingOpenAI(ctx context.Context, opts OpenAIOptions) error {
+	apiKey := opts.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if apiKey == "" {
+		return fmt.Errorf("OpenAI API key not provided (use --api-key or set OPENAI_API_KEY)")
+	}
+	if opts.Model == "" {
+		opts.Model = defaultOpenAIModel
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", openAIModelsURL+opts.Model, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("OpenAI request failed: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return fmt.Errorf("OpenAI rejected the API key")
+	case http.StatusNotFound:
+		return fmt.Errorf("OpenAI has no model %q", opts.Model)
+	default:
+		return fmt.Errorf("OpenAI returned %s", resp.Status)
+	}
+}
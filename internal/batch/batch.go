@@ -0,0 +1,177 @@
+// Package batch collects the programs to generate completions for when
+// many are given at once: from a list file, or every executable in PATH,
+// filtered with include/exclude globs.
+package batch
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DefaultExcludes are never probed in batch mode: they may act before
+// looking at their arguments (power management, killing or formatting
+// things, logging in), start a session, or are this tool. Entries are
+// globs matched against program names; the user's list (ExcludesPath)
+// extends it.
+var DefaultExcludes = []string{
+	// power and init
+	"reboot", "shutdown", "poweroff", "halt", "init", "telinit", "runlevel", "kexec",
+	"suspend", "hibernate", "pm-*", "rtcwake", "zzz",
+	// processes, devices and file systems
+	"kill", "killall", "killall5", "pkill", "xkill", "dd", "shred", "wipefs",
+	"mkfs", "mkfs.*", "mke2fs", "mkswap", "swapoff", "fdisk", "sfdisk", "cfdisk", "parted",
+	// logins and sessions
+	"login", "sulogin", "agetty", "getty", "nologin", "su", "sudo", "doas", "pkexec",
+	"vlock", "xinit", "startx", "X", "Xorg", "Xwayland",
+	// this tool
+	"theautocompletor",
+}
+
+// HelpStrategies are the help strategies tried on programs in batch mode
+// unless configured: only help flags, since programs that don't know the
+// "help" and "-help" strategies may take them as an argument to act on.
+var HelpStrategies = []string{"--help", "-h"}
+
+// ExcludesPath returns the user's list of programs batch mode never probes:
+// $XDG_CONFIG_HOME/theautocompletor/exclude, falling back to ~/.config.
+func ExcludesPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "theautocompletor", "exclude")
+}
+
+// Excludes returns DefaultExcludes with the user's list applied: one glob
+// per line is added, "!glob" removes an entry of the defaults. A missing
+// file is not an error.
+func Excludes() ([]string, error) {
+	excludes := slices.Clone(DefaultExcludes)
+	path := ExcludesPath()
+	if path == "" {
+		return excludes, nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return excludes, nil
+	}
+	lines, err := FromFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		if g, ok := strings.CutPrefix(l, "!"); ok {
+			excludes = slices.DeleteFunc(excludes, func(e string) bool { return e == g })
+			continue
+		}
+		if _, err := filepath.Match(l, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid glob %q: %w", path, l, err)
+		}
+		excludes = append(excludes, l)
+	}
+	return excludes, nil
+}
+
+// Excluded reports whether the base name of program matches one of the
+// exclude globs.
+func Excluded(program string, excludes []string) bool {
+	return matches(excludes, filepath.Base(program))
+}
+
+// FromFile reads program names from path ("-" for stdin), one per line.
+// Blank lines and lines starting with # are skipped.
+func FromFile(path string, stdin io.Reader) ([]string, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read program list: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var programs []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		programs = append(programs, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("could not read program list: %w", err)
+	}
+	return programs, nil
+}
+
+// InPath returns the name of every executable file in the directories of
+// $PATH, in PATH order, without duplicates.
+func InPath() []string {
+	var programs []string
+	seen := map[string]bool{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if seen[name] || strings.HasPrefix(name, ".") {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(dir, name)) // follows symlinks
+			if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+				continue
+			}
+			seen[name] = true
+			programs = append(programs, name)
+		}
+	}
+	return programs
+}
+
+// Filter keeps the programs whose base name matches one of the include
+// globs (all of them if there are none) and none of the exclude globs.
+// Duplicates are dropped.
+func Filter(programs, include, exclude []string) ([]string, error) {
+	for _, g := range append(slices.Clone(include), exclude...) {
+		if _, err := filepath.Match(g, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", g, err)
+		}
+	}
+	var out []string
+	for _, p := range programs {
+		name := filepath.Base(p)
+		if len(include) > 0 && !matches(include, name) {
+			continue
+		}
+		if matches(exclude, name) || slices.Contains(out, p) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func matches(globs []string, name string) bool {
+	for _, g := range globs {
+		if ok, _ := filepath.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFromFile(t *testing.T) {
+	got, err := FromFile("-", strings.NewReader("git\n\n# comment\n  kubectl  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"git", "kubectl"}; !slices.Equal(got, want) {
+		t.Errorf("FromFile = %v, want %v", got, want)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		programs, include, exclude, want []string
+	}{
+		{[]string{"git", "gh", "ls", "git"}, nil, nil, []string{"git", "gh", "ls"}},
+		{[]string{"git", "gh", "ls"}, []string{"g*"}, nil, []string{"git", "gh"}},
+		{[]string{"git", "gh", "/usr/bin/ls"}, nil, []string{"gh", "ls"}, []string{"git"}},
+	}
+	for _, tt := range tests {
+		got, err := Filter(tt.programs, tt.include, tt.exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Filter(%v, %v, %v) = %v, want %v", tt.programs, tt.include, tt.exclude, got, tt.want)
+		}
+	}
+	if _, err := Filter(nil, []string{"["}, nil); err == nil {
+		t.Error("Filter accepted an invalid glob")
+	}
+}
+
+func TestExcludes(t *testing.T) {
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+
+	excludes, err := Excludes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(excludes, DefaultExcludes) {
+		t.Errorf("without a file, Excludes = %v, want the defaults", excludes)
+	}
+
+	path := ExcludesPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("# mine\nnuke-*\n!dd\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	excludes, err = Excludes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		program string
+		want    bool
+	}{
+		{"reboot", true},
+		{"/usr/sbin/mkfs.ext4", true},
+		{"nuke-everything", true},
+		{"dd", false},
+		{"git", false},
+	}
+	for _, tt := range tests {
+		if got := Excluded(tt.program, excludes); got != tt.want {
+			t.Errorf("Excluded(%q) = %v, want %v", tt.program, got, tt.want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("[\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Excludes(); err == nil {
+		t.Error("Excludes accepted an invalid glob")
+	}
+}
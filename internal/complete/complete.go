@@ -0,0 +1,198 @@
+// Package complete answers runtime completion requests from generated
+// scripts: given a stored spec and the words on the command line, it returns
+// the candidates for the word being completed, running the flag's dynamic
+// source command when it has one.
+package complete
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+// DynamicTimeout limits how long a dynamic source command may run, so that a
+// slow command never blocks the shell for long.
+const DynamicTimeout = 2 * time.Second
+
+// Candidate is one completion offered to the shell.
+type Candidate struct {
+	Value       string
+	Description string
+}
+
+// Complete returns the candidates for the last of words, the words typed
+// after the program name (the last one may be empty).
+func Complete(ctx context.Context, root *model.Command, words []string) []Candidate {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cmd := root
+	path := []*model.Command{root} // cmd and its ancestors, root first
+	var pending *model.Flag        // flag waiting for its value
+	positional := 0
+	for _, w := range words[:len(words)-1] {
+		if pending != nil {
+			pending = nil
+			continue
+		}
+		if strings.HasPrefix(w, "-") && w != "-" && w != "--" {
+			name, _, hasValue := strings.Cut(w, "=")
+			if f := findFlag(path, name); f != nil && f.TakesArg && !hasValue {
+				pending = f
+			}
+			continue
+		}
+		if positional == 0 {
+			if sub := findSubcommand(cmd, w); sub != nil {
+				cmd = sub
+				path = append(path, sub)
+				continue
+			}
+		}
+		positional++
+	}
+
+	cur := words[len(words)-1]
+	switch {
+	case pending != nil:
+		return filter(values(ctx, pending), cur, "")
+	case strings.HasPrefix(cur, "--") && strings.Contains(cur, "="):
+		name, part, _ := strings.Cut(cur, "=")
+		if f := findFlag(path, name); f != nil && (f.TakesArg || f.OptionalArg) {
+			return filter(values(ctx, f), part, name+"=")
+		}
+		return nil
+	case strings.HasPrefix(cur, "-"):
+		return filter(flags(cmd), cur, "")
+	}
+
+	var out []Candidate
+	if positional == 0 {
+		for _, sub := range cmd.Subcommands {
+			for _, n := range sub.Names() {
+				out = append(out, Candidate{Value: n, Description: sub.Description})
+			}
+		}
+	}
+	if positional < len(cmd.Args) {
+		for _, c := range cmd.Args[positional].Choices {
+			out = append(out, Candidate{Value: c, Description: cmd.Args[positional].Description})
+		}
+	} else if n := len(cmd.Args); n > 0 && cmd.Args[n-1].Variadic {
+		for _, c := range cmd.Args[n-1].Choices {
+			out = append(out, Candidate{Value: c, Description: cmd.Args[n-1].Description})
+		}
+	}
+	return filter(out, cur, "")
+}
+
+// Write prints candidates one per line as "value\tdescription", the format
+// fish reads natively; the bash and zsh scripts split it.
+func Write(w io.Writer, candidates []Candidate) {
+	for _, c := range candidates {
+		if c.Description == "" {
+			fmt.Fprintln(w, c.Value)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\n", c.Value, c.Description)
+	}
+}
+
+// flags returns every spelling of the flags of cmd.
+func flags(cmd *model.Command) []Candidate {
+	var out []Candidate
+	for _, f := range cmd.Flags {
+		for _, n := range f.Names() {
+			out = append(out, Candidate{Value: n, Description: f.Description})
+		}
+		if negated := f.NegatedName(); negated != "" {
+			out = append(out, Candidate{Value: negated, Description: "Negate " + f.Long})
+		}
+	}
+	return out
+}
+
+// values returns the candidates for the value of f: its default, its fixed
+// values and the output of its dynamic source.
+func values(ctx context.Context, f *model.Flag) []Candidate {
+	var out []Candidate
+	if f.Default != "" {
+		out = append(out, Candidate{Value: f.Default, Description: "default"})
+	}
+	for _, v := range f.Values {
+		if v != f.Default {
+			out = append(out, Candidate{Value: v})
+		}
+	}
+	if f.Dynamic != "" {
+		out = append(out, runDynamic(ctx, f.Dynamic)...)
+	}
+	return out
+}
+
+// runDynamic runs a dynamic source command with sh and reads one candidate
+// per output line ("value" or "value\tdescription"). Errors yield no candidates.
+func runDynamic(ctx context.Context, command string) []Candidate {
+	ctx, cancel := context.WithTimeout(ctx, DynamicTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.WaitDelay = time.Second
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	_ = cmd.Run() // partial output is still useful
+
+	var out []Candidate
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		value, desc, _ := strings.Cut(strings.TrimRight(line, "\r"), "\t")
+		if value = strings.TrimSpace(value); value != "" {
+			out = append(out, Candidate{Value: value, Description: desc})
+		}
+	}
+	return out
+}
+
+// filter keeps the candidates starting with prefix, each prepended with
+// lead (e.g. "--color=" when completing --color=al), without duplicates.
+func filter(candidates []Candidate, prefix, lead string) []Candidate {
+	var out []Candidate
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		if !strings.HasPrefix(c.Value, prefix) || seen[c.Value] {
+			continue
+		}
+		seen[c.Value] = true
+		c.Value = lead + c.Value
+		out = append(out, c)
+	}
+	return out
+}
+
+// findFlag looks name up in the flags of the last command of path, then in
+// those of its ancestors: options added on the root (e.g. kubectl's
+// --namespace) are accepted after any subcommand.
+func findFlag(path []*model.Command, name string) *model.Flag {
+	for _, cmd := range slices.Backward(path) {
+		for i := range cmd.Flags {
+			if slices.Contains(cmd.Flags[i].Names(), name) {
+				return &cmd.Flags[i]
+			}
+		}
+	}
+	return nil
+}
+
+func findSubcommand(cmd *model.Command, name string) *model.Command {
+	for _, sub := range cmd.Subcommands {
+		if slices.Contains(sub.Names(), name) {
+			return sub
+		}
+	}
+	return nil
+}
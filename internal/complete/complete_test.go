@@ -0,0 +1,68 @@
+package complete
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+	"github.com/TerenceU/the-autocompletor/internal/overrides"
+)
+
+func candidateValues(candidates []Candidate) []string {
+	var out []string
+	for _, c := range candidates {
+		out = append(out, c.Value)
+	}
+	return out
+}
+
+// TestCompleteAncestorFlags completes "kubectl get -n <TAB>": the shipped
+// kubectl override adds --namespace to the root command only.
+func TestCompleteAncestorFlags(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("needs sh")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir()) // shipped overrides only
+	bin := t.TempDir()
+	kubectl := "#!/bin/sh\nprintf 'namespace/default\\nnamespace/kube-system\\n'\n"
+	if err := os.WriteFile(filepath.Join(bin, "kubectl"), []byte(kubectl), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	set, err := overrides.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := &model.Command{
+		Name: "kubectl",
+		Subcommands: []*model.Command{{
+			Name:  "get",
+			Flags: []model.Flag{{Short: "-o", Long: "--output", TakesArg: true, Values: []string{"json", "yaml"}}},
+			Args:  []model.Arg{{Name: "type", Choices: []string{"pods", "nodes"}}},
+		}},
+	}
+	overrides.Apply(root, set.For("kubectl"))
+
+	tests := []struct {
+		words []string
+		want  []string
+	}{
+		{[]string{"get", "-n", ""}, []string{"default", "kube-system"}},
+		{[]string{"get", "--namespace", "kube"}, []string{"kube-system"}},
+		{[]string{"get", "--namespace=d"}, []string{"--namespace=default"}},
+		// The value of a root flag is not taken for a positional argument
+		{[]string{"get", "-n", "default", ""}, []string{"pods", "nodes"}},
+		{[]string{"get", "-o", ""}, []string{"json", "yaml"}},
+	}
+	for _, tt := range tests {
+		got := candidateValues(Complete(context.Background(), root, tt.words))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Complete(%q) = %q, want %q", tt.words, got, tt.want)
+		}
+	}
+}
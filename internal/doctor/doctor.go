@@ -0,0 +1,399 @@
+// Package doctor checks the environment theautocompletor depends on: the
+// shells and tools it runs, whether shells load the completions it installs,
+// the AI backends and its own stored state. Every problem comes with what to
+// do about it.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/TerenceU/the-autocompletor/internal/ai"
+	"github.com/TerenceU/the-autocompletor/internal/installer"
+	"github.com/TerenceU/the-autocompletor/internal/lazy"
+	"github.com/TerenceU/the-autocompletor/internal/rc"
+	"github.com/TerenceU/the-autocompletor/internal/shell"
+	"github.com/TerenceU/the-autocompletor/internal/spec"
+)
+
+// pingTimeout limits each AI backend check.
+const pingTimeout = 5 * time.Second
+
+// Level is the severity of a finding.
+type Level int
+
+const (
+	OK   Level = iota
+	Info       // nothing wrong, but something is unavailable
+	Warn       // works, but not as well as it could
+	Fail       // something the user asked for cannot work
+)
+
+// Finding is the result of one check.
+type Finding struct {
+	Level   Level
+	Subject string
+	Message string
+	// Fix tells what to do about a problem; it may span several lines.
+	Fix string
+}
+
+// Section groups the findings about one topic.
+type Section struct {
+	Title    string
+	Findings []Finding
+}
+
+// Report is the outcome of Run.
+type Report struct {
+	Sections []Section
+}
+
+// Options selects what Run checks.
+type Options struct {
+	// Program, if set, is checked for conflicting completion scripts and
+	// whether shells load its completions.
+	Program string
+	// AI is the backend the user means to use ("ollama" or "openai"); it
+	// failing is a problem, while the other one is only reported.
+	AI     string
+	APIKey string
+	Model  string
+}
+
+// Run performs every check. It starts each installed shell once, with the
+// user's startup files, and contacts the AI backends.
+func Run(ctx context.Context, opts Options) Report {
+	var r Report
+	shells := r.checkShells()
+	r.checkTools()
+	loaded := r.checkSetup(ctx, shells, opts.Program)
+	r.checkAI(ctx, opts)
+	r.checkState()
+	if opts.Program != "" {
+		r.checkProgram(shells, opts.Program, loaded)
+	}
+	return r
+}
+
+func (r *Report) add(title string, f Finding) {
+	if n := len(r.Sections); n == 0 || r.Sections[n-1].Title != title {
+		r.Sections = append(r.Sections, Section{Title: title})
+	}
+	s := &r.Sections[len(r.Sections)-1]
+	s.Findings = append(s.Findings, f)
+}
+
+// checkShells reports which shells are installed, and returns them.
+func (r *Report) checkShells() []shell.Shell {
+	const title = "Shells"
+	installed := shell.Installed()
+	for _, sh := range shell.All {
+		if !slices.Contains(installed, sh) {
+			r.add(title, Finding{Level: Info, Subject: string(sh), Message: "not installed"})
+			continue
+		}
+		path, _ := exec.LookPath(string(sh)) // for display
+		r.add(title, Finding{Level: OK, Subject: string(sh), Message: path})
+	}
+	if len(installed) == 0 {
+		r.add(title, Finding{Level: Fail, Subject: "shells", Message: "none of bash, zsh and fish is installed",
+			Fix: "install one of them; completions can still be generated with --shell"})
+	}
+
+	sh, reason, err := shell.DetectReason()
+	if err != nil {
+		r.add(title, Finding{Level: Warn, Subject: "detected", Message: err.Error(),
+			Fix: "pass --shell fish|bash|zsh"})
+	} else {
+		r.add(title, Finding{Level: OK, Subject: "detected", Message: fmt.Sprintf("%s (%s)", sh, reason)})
+	}
+	return installed
+}
+
+// checkTools reports the programs man pages are read with.
+func (r *Report) checkTools() {
+	const title = "Tools"
+	tools := []struct {
+		name, fix string
+	}{
+		{"man", "install man (man-db or mandoc) so man pages are parsed too"},
+		{"col", "install col (util-linux, bsdextrautils on Debian and Ubuntu) so man pages are parsed too"},
+	}
+	for _, t := range tools {
+		path, err := exec.LookPath(t.name)
+		if err != nil {
+			r.add(title, Finding{Level: Warn, Subject: t.name, Message: "not found: only --help output is parsed", Fix: t.fix})
+			continue
+		}
+		r.add(title, Finding{Level: OK, Subject: t.name, Message: path})
+	}
+}
+
+// checkSetup starts every installed shell to check that it loads completions
+// from the per-user directory, and returns whether it loads those of program.
+func (r *Report) checkSetup(ctx context.Context, shells []shell.Shell, program string) map[shell.Shell]bool {
+	const title = "Completion setup"
+	probe := program
+	if probe == "" {
+		probe = "theautocompletor"
+	}
+	loaded := map[shell.Shell]bool{}
+	for _, sh := range shells {
+		dir := shell.CompletionsDir(sh)
+		res, err := rc.Check(ctx, sh, dir, probe)
+		if err != nil {
+			r.add(title, Finding{Level: Warn, Subject: string(sh), Message: "could not check: " + err.Error()})
+			continue
+		}
+		loaded[sh] = res.Loaded
+		if ready(sh, res) {
+			r.add(title, Finding{Level: OK, Subject: string(sh), Message: setupMessage(sh, dir)})
+			continue
+		}
+		if res.Loaded {
+			// e.g. bash sourcing the directory without bash-completion
+			r.add(title, Finding{Level: OK, Subject: string(sh), Message: "the startup files load completions from " + dir})
+			continue
+		}
+		finding := Finding{
+			Level:   Warn,
+			Subject: string(sh),
+			Message: fmt.Sprintf("completions in %s are not loaded: %s", dir, strings.Join(res.Reasons(sh), ", ")),
+		}
+		if snippet, err := rc.Snippet(sh, dir, res); err == nil {
+			finding.Fix = fmt.Sprintf("add to %s (or install with --setup-rc):\n%s", rc.File(sh), rc.Block(snippet))
+		}
+		r.add(title, finding)
+	}
+	return loaded
+}
+
+// ready reports whether sh picks up scripts installed in its per-user
+// directory, whether or not one exists yet.
+func ready(sh shell.Shell, res rc.Result) bool {
+	switch sh {
+	case shell.Zsh:
+		return res.InPath && res.Initialised
+	case shell.Bash:
+		return res.Initialised
+	default:
+		return res.InPath
+	}
+}
+
+func setupMessage(sh shell.Shell, dir string) string {
+	switch sh {
+	case shell.Zsh:
+		return dir + " is in fpath and compinit runs"
+	case shell.Bash:
+		return "bash-completion is loaded and reads " + dir
+	default:
+		return dir + " is in fish_complete_path"
+	}
+}
+
+// checkAI contacts the AI backends. Only the selected one being unavailable
+// is a problem.
+func (r *Report) checkAI(ctx context.Context, opts Options) {
+	const title = "AI backends"
+	unavailable := func(backend string) Level {
+		if opts.AI == backend {
+			return Fail
+		}
+		return Info
+	}
+	model := func(backend string) string {
+		if opts.AI == backend {
+			return opts.Model
+		}
+		return ""
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	err := ai.PingOllama(pingCtx, ai.OllamaOptions{Model: model("ollama")})
+	cancel()
+	switch {
+	case err == nil:
+		r.add(title, Finding{Level: OK, Subject: "ollama", Message: "reachable"})
+	case errors.Is(err, ai.ErrUnreachable):
+		r.add(title, Finding{Level: unavailable("ollama"), Subject: "ollama", Message: err.Error() + notNeeded(opts, "ollama"),
+			Fix: "start it with: ollama serve"})
+	default:
+		r.add(title, Finding{Level: unavailable("ollama"), Subject: "ollama", Message: err.Error() + notNeeded(opts, "ollama")})
+	}
+
+	if opts.APIKey == "" && os.Getenv("OPENAI_API_KEY") == "" && opts.AI != "openai" {
+		r.add(title, Finding{Level: Info, Subject: "openai", Message: "no API key" + notNeeded(opts, "openai")})
+		return
+	}
+	pingCtx, cancel = context.WithTimeout(ctx, pingTimeout)
+	err = ai.PingOpenAI(pingCtx, ai.OpenAIOptions{APIKey: opts.APIKey, Model: model("openai")})
+	cancel()
+	if err != nil {
+		r.add(title, Finding{Level: unavailable("openai"), Subject: "openai", Message: err.Error() + notNeeded(opts, "openai"),
+			Fix: "check --api-key or OPENAI_API_KEY, and --model"})
+	} else {
+		r.add(title, Finding{Level: OK, Subject: "openai", Message: "API key accepted"})
+	}
+}
+
+// notNeeded tells that backend is optional, unless it is the one selected.
+func notNeeded(opts Options, backend string) string {
+	if opts.AI == backend {
+		return ""
+	}
+	return " (only needed for --ai " + backend + ")"
+}
+
+// checkState checks the files theautocompletor keeps: the install
+// manifest, the stored specs and the lazy hooks' failure markers.
+func (r *Report) checkState() {
+	const title = "Stored state"
+	m, err := installer.LoadManifest()
+	if err != nil {
+		r.add(title, Finding{Level: Fail, Subject: "manifest", Message: err.Error(),
+			Fix: "fix or delete " + installer.ManifestPath() + " (installed scripts are then no longer tracked)"})
+	} else {
+		var outdated, missing, orphaned, unknown []string
+		for _, e := range m.Entries {
+			label := fmt.Sprintf("%s (%s)", e.Program, e.Shell)
+			switch e.Check() {
+			case installer.StatusOutdated:
+				outdated = append(outdated, label)
+			case installer.StatusMissing:
+				missing = append(missing, label)
+			case installer.StatusOrphaned:
+				orphaned = append(orphaned, label)
+			case installer.StatusUnknown:
+				unknown = append(unknown, label)
+			}
+		}
+		upToDate := len(m.Entries) - len(outdated) - len(missing) - len(orphaned) - len(unknown)
+		switch {
+		case len(outdated)+len(orphaned) > 0:
+			r.add(title, Finding{Level: Warn, Subject: "manifest",
+				Message: fmt.Sprintf("%d outdated, %d no longer installed (%s)",
+					len(outdated), len(orphaned), strings.Join(append(outdated, orphaned...), ", ")),
+				Fix: "run: theautocompletor refresh"})
+		case upToDate > 0:
+			r.add(title, Finding{Level: OK, Subject: "manifest", Message: fmt.Sprintf("%d installed, up to date", upToDate)})
+		case len(m.Entries) == 0:
+			r.add(title, Finding{Level: OK, Subject: "manifest", Message: "no completions installed yet"})
+		}
+		if len(missing) > 0 {
+			r.add(title, Finding{Level: Warn, Subject: "manifest",
+				Message: "scripts deleted outside theautocompletor: " + strings.Join(missing, ", "),
+				Fix:     "reinstall them with theautocompletor refresh, or forget them with theautocompletor uninstall <program>"})
+		}
+		if len(unknown) > 0 {
+			r.add(title, Finding{Level: Info, Subject: "manifest",
+				Message: fmt.Sprintf("%d with unknown status, no program binary was recorded (%s)", len(unknown), strings.Join(unknown, ", ")),
+				Fix:     "changes of these programs are not detected; install them again to update them"})
+		}
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(spec.Dir(), "*.json"))
+	var broken []string
+	for _, p := range paths {
+		if _, err := spec.Load(strings.TrimSuffix(filepath.Base(p), ".json")); err != nil {
+			broken = append(broken, p)
+		}
+	}
+	if len(broken) > 0 {
+		r.add(title, Finding{Level: Warn, Subject: "specs",
+			Message: fmt.Sprintf("%d of %d stored specs cannot be read, runtime completion is off for them", len(broken), len(paths)),
+			Fix:     "delete them and reinstall the programs:\n" + strings.Join(broken, "\n")})
+	} else {
+		r.add(title, Finding{Level: OK, Subject: "specs", Message: fmt.Sprintf("%d stored in %s", len(paths), spec.Dir())})
+	}
+
+	if failed := lazy.Failed(); len(failed) > 0 {
+		r.add(title, Finding{Level: Info, Subject: "lazy",
+			Message: "the init hook gave up on: " + strings.Join(failed, ", "),
+			Fix:     "retry with theautocompletor install <program>, or delete " + filepath.Join(lazy.StateDir(), "*.failed")})
+	}
+}
+
+// checkProgram looks for completion scripts of program that may shadow
+// each other, and reports whether shells load them.
+func (r *Report) checkProgram(shells []shell.Shell, program string, loaded map[shell.Shell]bool) {
+	program = filepath.Base(program)
+	title := "Completions for " + program
+	if _, err := exec.LookPath(program); err != nil {
+		r.add(title, Finding{Level: Warn, Subject: program, Message: "not found in PATH"})
+	}
+	for _, sh := range shells {
+		paths := installer.ExistingAll(sh, program)
+		var labels []string
+		for _, p := range paths {
+			if installer.Generated(p) {
+				labels = append(labels, p+" (theautocompletor)")
+			} else {
+				labels = append(labels, p+" (other source)")
+			}
+		}
+		switch {
+		case len(paths) == 0:
+			r.add(title, Finding{Level: Info, Subject: string(sh), Message: "no completions",
+				Fix: fmt.Sprintf("run: theautocompletor install %s --shell %s", program, sh)})
+			continue
+		case len(paths) > 1:
+			r.add(title, Finding{Level: Warn, Subject: string(sh),
+				Message: fmt.Sprintf("%d scripts found, only one is used:", len(paths)),
+				Fix:     strings.Join(labels, "\n") + fmt.Sprintf("\nkeep one: delete the others, or theautocompletor uninstall %s --shell %s", program, sh)})
+		default:
+			r.add(title, Finding{Level: OK, Subject: string(sh), Message: labels[0]})
+		}
+		if l, checked := loaded[sh]; checked && !l {
+			r.add(title, Finding{Level: Warn, Subject: string(sh), Message: "new sessions do not load these completions",
+				Fix: "see Completion setup above; scripts outside the shell's directories are not picked up"})
+		}
+	}
+}
+
+// Problems returns the number of findings at level Fail.
+func (r Report) Problems() int {
+	n := 0
+	for _, s := range r.Sections {
+		for _, f := range s.Findings {
+			if f.Level == Fail {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+var marks = map[Level]string{OK: "✓", Info: "-", Warn: "!", Fail: "✗"}
+
+// Write prints the report, one section after another.
+func (r Report) Write(w io.Writer) {
+	for i, s := range r.Sections {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, s.Title)
+		for _, f := range s.Findings {
+			fmt.Fprintf(w, "  %s %s: %s\n", marks[f.Level], f.Subject, f.Message)
+			if f.Fix == "" {
+				continue
+			}
+			for j, line := range strings.Split(strings.TrimSuffix(f.Fix, "\n"), "\n") {
+				if j == 0 {
+					fmt.Fprintf(w, "    → %s\n", line)
+				} else {
+					fmt.Fprintf(w, "      %s\n", line)
+				}
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package generator
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/TerenceU/the-autocompletor/internal/model"
@@ -16,53 +17,240 @@ func Bash(cmd *model.Command) string {
 	fmt.Fprintf(&b, "# Bash completions for %s (generated by theautocompletor)\n\n", name)
 	fmt.Fprintf(&b, "%s() {\n", fnName)
 	b.WriteString("    local cur prev words cword\n")
-	b.WriteString("    _init_completion || return\n\n")
+	// "=" stays in cur, so "--color=al" is matched by the --color=* cases
+	b.WriteString("    _init_completion -n = || return\n\n")
+	b.WriteString(bashEqualsCases(cmd))
+	b.WriteString(bashValueCases(cmd))
 
+	// $cmd is the path of the (sub)command being completed, "prog sub", and
+	// $subi the index of its last word
+	fmt.Fprintf(&b, "    local cmd=%q subi=0\n", name)
 	if len(cmd.Subcommands) > 0 {
-		subNames := make([]string, len(cmd.Subcommands))
-		for i, s := range cmd.Subcommands {
-			subNames[i] = s.Name
-		}
-		fmt.Fprintf(&b, "    local subcommands=%q\n\n", strings.Join(subNames, " "))
+		b.WriteString("    local i\n")
+		b.WriteString("    for ((i = 1; i < cword; i++)); do\n")
+		b.WriteString("        case \"$cmd ${words[i]}\" in\n")
+		walkCommands(cmd, name, func(c *model.Command, path string) {
+			for _, sub := range c.Subcommands {
+				var patterns []string
+				for _, n := range sub.Names() {
+					patterns = append(patterns, fmt.Sprintf("%q", path+" "+n))
+				}
+				fmt.Fprintf(&b, "            %s)\n                cmd=%q; subi=$i ;;\n",
+					strings.Join(patterns, "|"), path+" "+sub.Name)
+			}
+		})
+		b.WriteString("        esac\n")
+		b.WriteString("    done\n")
+	}
+	b.WriteString("\n")
 
-		b.WriteString("    # Find if a subcommand has been given\n")
-		b.WriteString("    local sub=''\n")
-		b.WriteString("    for w in \"${words[@]:1}\"; do\n")
-		b.WriteString("        case \"$w\" in\n")
-		for _, sub := range cmd.Subcommands {
-			flags := buildFlagList(sub.Flags)
-			fmt.Fprintf(&b, "            %s)\n                sub=%s; local sub_flags=%q ;;\n", sub.Name, sub.Name, flags)
+	var arms strings.Builder
+	walkCommands(cmd, name, func(c *model.Command, path string) {
+		var subNames []string
+		for _, sub := range c.Subcommands {
+			subNames = append(subNames, sub.Names()...)
 		}
+		if cases := bashArgCases(c.Args, subNames, "                "); cases != "" {
+			fmt.Fprintf(&arms, "            %q)\n%s                ;;\n", path, cases)
+		}
+	})
+	if arms.Len() > 0 {
+		b.WriteString(bashArgCount("    "))
+		b.WriteString("        case \"$cmd\" in\n")
+		b.WriteString(arms.String())
 		b.WriteString("        esac\n")
-		b.WriteString("    done\n\n")
-
-		b.WriteString("    if [[ -n \"$sub\" ]]; then\n")
-		b.WriteString("        COMPREPLY=($(compgen -W \"$sub_flags\" -- \"$cur\"))\n")
-		b.WriteString("        return\n")
 		b.WriteString("    fi\n\n")
-
-		rootFlags := buildFlagList(cmd.Flags)
-		fmt.Fprintf(&b, "    COMPREPLY=($(compgen -W \"$subcommands %s\" -- \"$cur\"))\n", rootFlags)
-	} else {
-		flags := buildFlagList(cmd.Flags)
-		fmt.Fprintf(&b, "    COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", flags)
 	}
 
+	b.WriteString("    case \"$cmd\" in\n")
+	walkCommands(cmd, name, func(c *model.Command, path string) {
+		var words []string
+		for _, sub := range c.Subcommands {
+			words = append(words, sub.Names()...)
+		}
+		if flags := buildFlagList(c.Flags); flags != "" {
+			words = append(words, flags)
+		}
+		fmt.Fprintf(&b, "        %q)\n            COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", path, strings.Join(words, " "))
+	})
+	b.WriteString("    esac\n")
+	b.WriteString(bashNoSpaceAfterEquals("    "))
+
 	b.WriteString("}\n\n")
 	fmt.Fprintf(&b, "complete -F %s %s\n", fnName, name)
 
 	return b.String()
 }
 
+// bashArgCount opens a block for words that are not flags and counts the
+// positional arguments before the current word, after the word at $subi.
+// Flag values are counted too: the script doesn't know which flags take one.
+func bashArgCount(indent string) string {
+	return indent + "if [[ $cur != -* ]]; then\n" +
+		indent + "    local arg=0 w\n" +
+		indent + "    for w in \"${words[@]:subi+1:cword-subi-1}\"; do\n" +
+		indent + "        [[ $w == -* ]] || ((arg++))\n" +
+		indent + "    done\n"
+}
+
+// bashArgCases completes positional argument number $arg (from 0) of a
+// command: its choices, or file names for arguments without any. A variadic
+// argument takes every following position. subNames are the subcommands of
+// the command, offered along with the first argument instead of file names.
+func bashArgCases(args []model.Arg, subNames []string, indent string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(indent + "case $arg in\n")
+	for i, a := range args {
+		pos := fmt.Sprint(i)
+		if a.Variadic {
+			pos = "*" // earlier positions have their own arms above
+		}
+		if i == 0 && len(subNames) > 0 {
+			if a.Variadic {
+				pos = "0"
+			}
+			fmt.Fprintf(&b, "%s    %s)\n", indent, pos)
+			if len(a.Choices) > 0 {
+				fmt.Fprintf(&b, "%s        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", indent, strings.Join(append(slices.Clone(a.Choices), subNames...), " "))
+				fmt.Fprintf(&b, "%s        return\n", indent)
+			}
+			fmt.Fprintf(&b, "%s        ;;\n", indent) // subcommands and flags below
+			if !a.Variadic {
+				continue
+			}
+			pos = "*"
+		}
+		fmt.Fprintf(&b, "%s    %s)\n", indent, pos)
+		if len(a.Choices) > 0 {
+			fmt.Fprintf(&b, "%s        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", indent, strings.Join(a.Choices, " "))
+		} else {
+			fmt.Fprintf(&b, "%s        compopt -o default 2>/dev/null\n", indent)
+			fmt.Fprintf(&b, "%s        COMPREPLY=()\n", indent)
+		}
+		fmt.Fprintf(&b, "%s        return\n", indent)
+		fmt.Fprintf(&b, "%s        ;;\n", indent)
+		if a.Variadic {
+			break
+		}
+	}
+	b.WriteString(indent + "esac\n")
+	return b.String()
+}
+
+// bashNoSpaceAfterEquals keeps the cursor right after a completed "--flag="
+// so the value can be typed in the same word.
+func bashNoSpaceAfterEquals(indent string) string {
+	return indent + "[[ ${COMPREPLY[0]} == *= ]] && compopt -o nospace\n"
+}
+
 func buildFlagList(flags []model.Flag) string {
 	var parts []string
 	for _, f := range flags {
-		if f.Short != "" {
-			parts = append(parts, f.Short)
+		for _, n := range f.Names() {
+			switch {
+			case !f.EqualsForm || !strings.HasPrefix(n, "--"):
+				parts = append(parts, n)
+			case f.TakesArg:
+				parts = append(parts, n+"=") // value must follow: --output=FILE
+			case f.OptionalArg:
+				parts = append(parts, n, n+"=") // --color or --color=WHEN
+			default:
+				parts = append(parts, n)
+			}
 		}
-		if f.Long != "" {
-			parts = append(parts, f.Long)
+		if negated := f.NegatedName(); negated != "" {
+			parts = append(parts, negated)
 		}
 	}
 	return strings.Join(parts, " ")
 }
+
+// bashValueCases completes the values of flags that take one, from the
+// previous word: fixed values, or runtime candidates for flags with a dynamic
+// source. Flags anywhere in the tree are matched; the first wins.
+func bashValueCases(cmd *model.Command) string {
+	seen := map[string]bool{}
+	var b strings.Builder
+	var walk func(c *model.Command)
+	walk = func(c *model.Command) {
+		for _, f := range c.Flags {
+			if !f.TakesArg || (len(f.Values) == 0 && f.Dynamic == "") {
+				continue
+			}
+			var names []string
+			for _, n := range f.Names() {
+				if !seen[n] {
+					seen[n] = true
+					names = append(names, n)
+				}
+			}
+			if len(names) == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "        %s)\n", strings.Join(names, "|"))
+			if f.Dynamic != "" {
+				fmt.Fprintf(&b, "            COMPREPLY=($(compgen -W \"$(%s %s \"${words[@]:1:cword}\" 2>/dev/null | cut -f1)\" -- \"$cur\"))\n",
+					completeCommand, cmd.Name)
+			} else {
+				fmt.Fprintf(&b, "            COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(f.Values, " "))
+			}
+			b.WriteString("            return\n")
+			b.WriteString("            ;;\n")
+		}
+		for _, sub := range c.Subcommands {
+			walk(sub)
+		}
+	}
+	walk(cmd)
+	if b.Len() == 0 {
+		return ""
+	}
+	return "    case \"$prev\" in\n" + b.String() + "    esac\n\n"
+}
+
+// bashEqualsCases completes values attached with "=" to long flags, from
+// the current word: --output=FILE, and --color=WHEN for flags whose value is
+// optional, which never take the next word. Only the part after "=" is
+// replaced, since bash breaks words there.
+func bashEqualsCases(cmd *model.Command) string {
+	seen := map[string]bool{}
+	var b strings.Builder
+	var walk func(c *model.Command)
+	walk = func(c *model.Command) {
+		for _, f := range c.Flags {
+			if !f.TakesArg && !f.OptionalArg || (len(f.Values) == 0 && f.Dynamic == "") {
+				continue
+			}
+			var names []string
+			for _, n := range f.Names() {
+				if strings.HasPrefix(n, "--") && !seen[n] {
+					seen[n] = true
+					names = append(names, n+"=*")
+				}
+			}
+			if len(names) == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "        %s)\n", strings.Join(names, "|"))
+			if f.Dynamic != "" {
+				fmt.Fprintf(&b, "            COMPREPLY=($(compgen -W \"$(%s %s \"${words[@]:1:cword}\" 2>/dev/null | cut -f1 | sed 's/^[^=]*=//')\" -- \"${cur#*=}\"))\n",
+					completeCommand, cmd.Name)
+			} else {
+				fmt.Fprintf(&b, "            COMPREPLY=($(compgen -W %q -- \"${cur#*=}\"))\n", strings.Join(f.Values, " "))
+			}
+			b.WriteString("            return\n")
+			b.WriteString("            ;;\n")
+		}
+		for _, sub := range c.Subcommands {
+			walk(sub)
+		}
+	}
+	walk(cmd)
+	if b.Len() == 0 {
+		return ""
+	}
+	return "    case \"$cur\" in\n" + b.String() + "    esac\n\n"
+}
@@ -0,0 +1,172 @@
+package generator
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+// bashComplete sources script in bash and completes line, with
+// _init_completion -n = reduced to what the script relies on: the words of
+// the line, "=" kept inside them.
+func bashComplete(t *testing.T, script, line string) []string {
+	t.Helper()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("needs bash")
+	}
+	driver := `
+_init_completion() {
+    words=($LINE)
+    [[ $LINE == *" " ]] && words+=("")
+    cword=$((${#words[@]} - 1))
+    cur=${words[cword]}
+    prev=${words[cword-1]}
+}
+compopt() { :; }
+` + script + `
+COMPREPLY=()
+_` + strings.Fields(line)[0] + `
+printf '%s\n' "${COMPREPLY[@]}"
+`
+	cmd := exec.Command("bash", "-c", driver)
+	cmd.Env = append(cmd.Environ(), "LINE="+line)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("bash: %v", err)
+	}
+	return strings.Fields(string(out))
+}
+
+func TestBashOptionalValue(t *testing.T) {
+	root := &model.Command{
+		Name: "demo",
+		Flags: []model.Flag{
+			{Long: "--color", OptionalArg: true, EqualsForm: true, Values: []string{"always", "auto", "never"}},
+			{Short: "-o", Long: "--output", TakesArg: true, EqualsForm: true, Values: []string{"json", "yaml"}},
+		},
+	}
+	script := Bash(root)
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"demo --co", "--color --color="},
+		{"demo --color=a", "always auto"},
+		{"demo --color=", "always auto never"},
+		{"demo --output=y", "yaml"},
+		{"demo -o ", "json yaml"},
+		{"demo --out", "--output="},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(bashComplete(t, script, tt.line), " "); got != tt.want {
+			t.Errorf("%q completes to %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+// positionalTree has positional arguments on a subcommand and on a command
+// without subcommands.
+func positionalTree() *model.Command {
+	return &model.Command{
+		Name:  "demo",
+		Flags: []model.Flag{{Long: "--verbose"}},
+		Subcommands: []*model.Command{
+			{
+				Name:    "start",
+				Aliases: []string{"up"},
+				Flags:   []model.Flag{{Long: "--detach"}},
+				Args: []model.Arg{
+					{Name: "service", Choices: []string{"web", "db"}},
+					{Name: "mode", Optional: true, Choices: []string{"fast", "slow"}},
+					{Name: "extra", Variadic: true, Choices: []string{"x", "y"}},
+				},
+			},
+			{Name: "stop", Flags: []model.Flag{{Long: "--all"}}},
+		},
+	}
+}
+
+func TestBashPositionals(t *testing.T) {
+	script := Bash(positionalTree())
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"demo ", "start up stop --verbose"},
+		{"demo start ", "web db"},
+		{"demo up w", "web"},
+		{"demo start --detach ", "web db"},
+		{"demo start web ", "fast slow"},
+		{"demo start web fast x ", "x y"},
+		{"demo start -", "--detach"},
+		{"demo stop ", "--all"},
+		// An argument that is also a subcommand name is not a subcommand
+		{"demo start stop ", "fast slow"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(bashComplete(t, script, tt.line), " "); got != tt.want {
+			t.Errorf("%q completes to %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	leaf := &model.Command{Name: "leaf", Args: []model.Arg{{Name: "action", Choices: []string{"on", "off"}}}}
+	if got := strings.Join(bashComplete(t, Bash(leaf), "leaf o"), " "); got != "on off" {
+		t.Errorf("\"leaf o\" completes to %q, want \"on off\"", got)
+	}
+}
+
+// nestedTree has two levels of subcommands and a root that takes positional
+// arguments besides its subcommands.
+func nestedTree() *model.Command {
+	return &model.Command{
+		Name:  "demo",
+		Flags: []model.Flag{{Long: "--verbose"}},
+		Args: []model.Arg{
+			{Name: "target", Choices: []string{"here", "there"}},
+			{Name: "level", Choices: []string{"low", "high"}},
+		},
+		Subcommands: []*model.Command{
+			{
+				Name:  "remote",
+				Flags: []model.Flag{{Long: "--all"}},
+				Subcommands: []*model.Command{
+					{
+						Name:    "add",
+						Aliases: []string{"new"},
+						Flags:   []model.Flag{{Short: "-f"}},
+						Args: []model.Arg{
+							{Name: "name", Choices: []string{"origin", "upstream"}},
+							{Name: "protocol", Choices: []string{"ssh", "https"}},
+						},
+					},
+					{Name: "list"},
+				},
+			},
+		},
+	}
+}
+
+func TestBashNested(t *testing.T) {
+	script := Bash(nestedTree())
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"demo ", "here there remote"},
+		{"demo -", "--verbose"},
+		{"demo here ", "low high"},
+		{"demo remote ", "add new list --all"},
+		{"demo remote add ", "origin upstream"},
+		{"demo remote new o", "origin"},
+		{"demo remote add origin ", "ssh https"},
+		{"demo remote add -", "-f"},
+		{"demo remote --all add ", "origin upstream"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(bashComplete(t, script, tt.line), " "); got != tt.want {
+			t.Errorf("%q completes to %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package generator
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/TerenceU/the-autocompletor/internal/model"
@@ -13,93 +14,248 @@ func Fish(cmd *model.Command) string {
 
 	fmt.Fprintf(&b, "# Fish completions for %s (generated by theautocompletor)\n\n", cmd.Name)
 
-	if len(cmd.Subcommands) > 0 {
-		// Subcommand names for __fish_use_subcommand
-		b.WriteString("# Subcommands\n")
-		for _, sub := range cmd.Subcommands {
-			desc := escapeFish(sub.Description)
-			fmt.Fprintf(&b, "complete -c %s -f -n __fish_use_subcommand -a %s -d %q\n",
-				cmd.Name, sub.Name, desc)
+	if hasDynamic(cmd) {
+		// Values of flags with a dynamic source are computed at runtime.
+		fmt.Fprintf(&b, "function %s\n", fishCompleteFunc(cmd.Name))
+		b.WriteString("    set -l words (commandline -opc) (commandline -ct)\n")
+		fmt.Fprintf(&b, "    %s %s $words[2..-1]\n", completeCommand, cmd.Name)
+		b.WriteString("end\n\n")
+	}
+	if hasArgHints(cmd) {
+		// Positional argument hints: show label+description in TAB menu without inserting text.
+		// The helper function returns (commandline -ct) as completion value so selecting it
+		// is a no-op; the tab-separated description shows "NAME — desc" in the menu.
+		fmt.Fprintf(&b, "function %s\n", fishHintFunc(cmd.Name))
+		b.WriteString("    printf '%s\\t%s\\n' (commandline -ct) $argv[1]\n")
+		b.WriteString("end\n\n")
+	}
+
+	if len(cmd.Subcommands) == 0 {
+		fishArgs(&b, cmd.Name, cmd.Args, nil, "")
+		// Flat flags
+		for _, f := range cmd.Flags {
+			b.WriteString(fishFlag(cmd.Name, "", f))
 		}
-		b.WriteString("\n")
+		return b.String()
+	}
+	fishCommand(&b, cmd.Name, cmd, nil)
+	return b.String()
+}
 
-		// Root flags
-		if len(cmd.Flags) > 0 {
-			b.WriteString("# Global flags\n")
-			for _, f := range cmd.Flags {
-				b.WriteString(fishFlag(cmd.Name, "", f))
-			}
-			b.WriteString("\n")
+// fishCommand writes the completions of c, a command with subcommands or
+// below one, reached through path (the subcommands before it, outermost
+// first), then those of its subcommands.
+func fishCommand(b *strings.Builder, root string, c *model.Command, path []*model.Command) {
+	// seen holds once every subcommand of path is on the command line; at
+	// also requires that none of the subcommands of c is.
+	var seen []string
+	for _, p := range path {
+		seen = append(seen, "__fish_seen_subcommand_from "+strings.Join(p.Names(), " "))
+	}
+	at := slices.Clone(seen)
+	if len(c.Subcommands) > 0 {
+		var children []string
+		for _, sub := range c.Subcommands {
+			children = append(children, sub.Names()...)
 		}
+		at = append(at, "not __fish_seen_subcommand_from "+strings.Join(children, " "))
+	}
 
-		// Per-subcommand flags
-		for _, sub := range cmd.Subcommands {
-			if len(sub.Flags) == 0 {
-				continue
-			}
-			fmt.Fprintf(&b, "# %s\n", sub.Name)
-			for _, f := range sub.Flags {
-				b.WriteString(fishFlag(cmd.Name, sub.Name, f))
+	if len(path) > 0 && len(c.Flags) > 0 {
+		fmt.Fprintf(b, "# %s\n", commandPath(path))
+		for _, f := range c.Flags {
+			b.WriteString(fishFlag(root, strings.Join(seen, "; and "), f))
+		}
+		b.WriteString("\n")
+	}
+	if len(c.Subcommands) > 0 {
+		// Subcommand names
+		if len(path) == 0 {
+			b.WriteString("# Subcommands\n")
+		} else {
+			fmt.Fprintf(b, "# Subcommands of %s\n", commandPath(path))
+		}
+		cond := strings.Join(at, "; and ")
+		if len(path) == 0 {
+			cond = "__fish_use_subcommand"
+		}
+		for _, sub := range c.Subcommands {
+			desc := escapeFish(sub.Description)
+			for _, name := range sub.Names() {
+				fmt.Fprintf(b, "complete -c %s -f -n %q -a %s -d %q\n", root, cond, name, desc)
 			}
-			b.WriteString("\n")
 		}
+		b.WriteString("\n")
+	}
+	if len(path) == 0 && len(c.Flags) > 0 {
+		b.WriteString("# Global flags\n")
+		for _, f := range c.Flags {
+			b.WriteString(fishFlag(root, "", f))
+		}
+		b.WriteString("\n")
+	}
+	fishArgs(b, root, c.Args, path, strings.Join(at, "; and "))
+
+	for _, sub := range c.Subcommands {
+		fishCommand(b, root, sub, append(slices.Clone(path), sub))
+	}
+}
+
+// fishArgs writes the positional argument hints of a command reached
+// through path, offered while the condition at holds.
+func fishArgs(b *strings.Builder, root string, args []model.Arg, path []*model.Command, at string) {
+	if len(args) == 0 {
+		return
+	}
+	if len(path) == 0 {
+		b.WriteString("# Positional argument hints\n")
 	} else {
-		// Positional argument hints: show label+description in TAB menu without inserting text.
-		// The helper function returns (commandline -ct) as completion value so selecting it
-		// is a no-op; the tab-separated description shows "NAME — desc" in the menu.
-		if len(cmd.Args) > 0 {
-			helperName := fmt.Sprintf("__theautocompletor_%s_pos_hint", cmd.Name)
-			fmt.Fprintf(&b, "function %s\n", helperName)
-			b.WriteString("    printf '%s\\t%s\\n' (commandline -ct) $argv[1]\n")
-			b.WriteString("end\n\n")
-
-			b.WriteString("# Positional argument hints\n")
-			for i, arg := range cmd.Args {
-				label := strings.ToUpper(strings.ReplaceAll(arg.Name, "-", "_"))
-				hint := label
-				if arg.Description != "" {
-					hint = label + " — " + escapeFish(arg.Description)
-				}
-				fmt.Fprintf(&b,
-					"complete -c %s -n 'test (count (commandline -opc)) -eq %d' -f -a '(%s %q)'\n",
-					cmd.Name, i+1, helperName, hint)
+		fmt.Fprintf(b, "# Positional argument hints (%s)\n", commandPath(path))
+	}
+	for i, arg := range args {
+		// Words before this one: the program, the subcommands of path and
+		// the arguments before. A variadic argument keeps matching for every
+		// following word.
+		cmp := "-eq"
+		if arg.Variadic {
+			cmp = "-ge"
+		}
+		cond := fmt.Sprintf("test (count (commandline -opc)) %s %d", cmp, len(path)+i+1)
+		if at != "" {
+			cond = at + "; and " + cond
+		}
+
+		if len(arg.Choices) > 0 {
+			fmt.Fprintf(b, "complete -c %s -n '%s' -f -a %q",
+				root, cond, strings.Join(arg.Choices, " "))
+			if arg.Description != "" {
+				fmt.Fprintf(b, " -d %q", escapeFish(arg.Description))
 			}
 			b.WriteString("\n")
+		} else {
+			label := strings.ToUpper(strings.ReplaceAll(arg.Name, "-", "_"))
+			if arg.Variadic {
+				label += "..."
+			}
+			hint := label
+			if arg.Description != "" {
+				hint = label + " — " + escapeFish(arg.Description)
+			}
+			fmt.Fprintf(b,
+				"complete -c %s -n '%s' -f -a '(%s %q)'\n",
+				root, cond, fishHintFunc(root), hint)
 		}
-
-		// Flat flags
-		for _, f := range cmd.Flags {
-			b.WriteString(fishFlag(cmd.Name, "", f))
+		if arg.Variadic {
+			break
 		}
 	}
+	b.WriteString("\n")
+}
 
-	return b.String()
+// fishHintFunc is the name of the function showing positional argument hints.
+func fishHintFunc(cmdName string) string {
+	return fmt.Sprintf("__theautocompletor_%s_pos_hint", cmdName)
 }
 
-func fishFlag(cmdName, subName string, f model.Flag) string {
+// hasArgHints reports whether any command in the tree has a positional
+// argument without fixed choices, shown as a hint.
+func hasArgHints(cmd *model.Command) bool {
+	for _, a := range cmd.Args {
+		if len(a.Choices) == 0 {
+			return true
+		}
+	}
+	return slices.ContainsFunc(cmd.Subcommands, hasArgHints)
+}
+
+// fishFlag renders one flag; cond is the condition under which the command
+// it belongs to is on the command line, empty for the root.
+func fishFlag(cmdName, cond string, f model.Flag) string {
 	var parts []string
 	parts = append(parts, fmt.Sprintf("complete -c %s", cmdName))
 
-	if subName != "" {
-		parts = append(parts, fmt.Sprintf("-n \"__fish_seen_subcommand_from %s\"", subName))
+	var conds []string
+	if cond != "" {
+		conds = append(conds, cond)
+	}
+	if guard := fishExclusionGuard(f); guard != "" {
+		conds = append(conds, guard)
+	}
+	if len(conds) > 0 {
+		parts = append(parts, fmt.Sprintf("-n %q", strings.Join(conds, "; and ")))
 	}
 
-	if f.Short != "" {
-		short := strings.TrimPrefix(f.Short, "-")
-		parts = append(parts, fmt.Sprintf("-s %s", short))
+	for _, name := range f.Names() {
+		switch {
+		case strings.HasPrefix(name, "--"):
+			parts = append(parts, fmt.Sprintf("-l %s", strings.TrimPrefix(name, "--")))
+		case len(name) == 2:
+			parts = append(parts, fmt.Sprintf("-s %s", strings.TrimPrefix(name, "-")))
+		default:
+			// Old-style (single-dash long) option, e.g. -verbose
+			parts = append(parts, fmt.Sprintf("-o %s", strings.TrimPrefix(name, "-")))
+		}
 	}
-	if f.Long != "" {
-		long := strings.TrimPrefix(f.Long, "--")
-		parts = append(parts, fmt.Sprintf("-l %s", long))
+	if f.TakesArg || f.OptionalArg {
+		// An optional value is only ever attached (--color=auto): no -r,
+		// so the next word stays an argument of its own
+		if f.TakesArg {
+			parts = append(parts, "-x")
+		} else {
+			parts = append(parts, "-f")
+		}
+		if f.Dynamic != "" {
+			parts = append(parts, fmt.Sprintf("-a '(%s)'", fishCompleteFunc(cmdName)))
+		} else if values := flagValues(f); len(values) > 0 {
+			// The default value, if any, is offered as the first candidate
+			parts = append(parts, fmt.Sprintf("-a %q", escapeFish(strings.Join(values, " "))))
+		}
 	}
-	if f.TakesArg {
-		parts = append(parts, "-x")
+	if desc := flagDescription(f); desc != "" {
+		parts = append(parts, fmt.Sprintf("-d %q", escapeFish(desc)))
 	}
-	if f.Description != "" {
-		parts = append(parts, fmt.Sprintf("-d %q", escapeFish(f.Description)))
+
+	out := strings.Join(parts, " ") + "\n"
+
+	if negated := f.NegatedName(); negated != "" {
+		neg := []string{fmt.Sprintf("complete -c %s", cmdName)}
+		if len(conds) > 0 {
+			neg = append(neg, fmt.Sprintf("-n %q", strings.Join(conds, "; and ")))
+		}
+		neg = append(neg, "-l "+strings.TrimPrefix(negated, "--"), fmt.Sprintf("-d %q", "Negate "+f.Long))
+		out += strings.Join(neg, " ") + "\n"
 	}
+	return out
+}
+
+// fishExclusionGuard returns a condition that hides a flag once it (unless it
+// may be repeated) or a flag it cannot be combined with is on the command line.
+func fishExclusionGuard(f model.Flag) string {
+	var names []string
+	if !f.Repeatable {
+		names = append(f.Names(), f.NegatedName())
+	}
+	names = append(names, f.Excludes...)
+
+	var args []string
+	for _, n := range names {
+		switch {
+		case strings.HasPrefix(n, "--"):
+			args = append(args, strings.TrimPrefix(n, "--"))
+		case len(n) == 2 && n[0] == '-':
+			args = append(args, "-s "+n[1:])
+		}
+		// Old-style options can't be checked by __fish_contains_opt.
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return "not __fish_contains_opt " + strings.Join(args, " ")
+}
 
-	return strings.Join(parts, " ") + "\n"
+// fishCompleteFunc is the name of the function asking for runtime candidates.
+func fishCompleteFunc(cmdName string) string {
+	return fmt.Sprintf("__theautocompletor_%s_complete", cmdName)
 }
 
 func escapeFish(s string) string {
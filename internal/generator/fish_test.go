@@ -0,0 +1,48 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+func TestFishNested(t *testing.T) {
+	script := Fish(nestedTree())
+	for _, want := range []string{
+		`-n 'not __fish_seen_subcommand_from remote; and test (count (commandline -opc)) -eq 1' -f -a "here there"`,
+		`-n 'not __fish_seen_subcommand_from remote; and test (count (commandline -opc)) -eq 2' -f -a "low high"`,
+		`-n "__fish_seen_subcommand_from remote; and not __fish_seen_subcommand_from add new list" -a add`,
+		`-n '__fish_seen_subcommand_from remote; and __fish_seen_subcommand_from add new; and test (count (commandline -opc)) -eq 3' -f -a "origin upstream"`,
+		`-n '__fish_seen_subcommand_from remote; and __fish_seen_subcommand_from add new; and test (count (commandline -opc)) -eq 4' -f -a "ssh https"`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script lacks %s:\n%s", want, script)
+		}
+	}
+}
+
+func TestFishOptionalValue(t *testing.T) {
+	root := &model.Command{
+		Name: "demo",
+		Flags: []model.Flag{
+			{Long: "--color", OptionalArg: true, EqualsForm: true, Values: []string{"always", "auto", "never"}},
+			{Short: "-o", Long: "--output", TakesArg: true, Values: []string{"json", "yaml"}},
+			{Long: "--verbose"},
+		},
+	}
+	script := Fish(root)
+	for _, want := range []string{
+		`-l color -f -a "always auto never"`,
+		`-s o -l output -x -a "json yaml"`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script lacks %s:\n%s", want, script)
+		}
+	}
+	for _, line := range strings.Split(script, "\n") {
+		if strings.Contains(line, "-l color") && strings.Contains(line, " -r") {
+			t.Errorf("optional value required: %s", line)
+		}
+	}
+}
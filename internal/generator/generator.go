@@ -0,0 +1,81 @@
+// Package generator renders a model.Command tree as a shell completion script.
+package generator
+
+import (
+	"strings"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+// flagDescription returns the description shown next to a flag, with its
+// default value and environment variable appended: "Port (default: 8080, env: PORT)".
+func flagDescription(f model.Flag) string {
+	var extra []string
+	if f.Default != "" {
+		extra = append(extra, "default: "+f.Default)
+	}
+	if f.Env != "" {
+		extra = append(extra, "env: "+f.Env)
+	}
+	if len(extra) == 0 {
+		return f.Description
+	}
+	suffix := "(" + strings.Join(extra, ", ") + ")"
+	if f.Description == "" {
+		return suffix
+	}
+	return f.Description + " " + suffix
+}
+
+// flagValues returns the value candidates of a flag: its default first, then
+// its fixed values.
+func flagValues(f model.Flag) []string {
+	var values []string
+	if f.Default != "" {
+		values = append(values, f.Default)
+	}
+	for _, v := range f.Values {
+		if v != f.Default {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// completeCommand is how generated scripts ask theautocompletor for runtime
+// candidates; see package complete.
+const completeCommand = "theautocompletor __complete"
+
+// hasDynamic reports whether any flag in the tree has a dynamic source.
+func hasDynamic(cmd *model.Command) bool {
+	for _, f := range cmd.Flags {
+		if f.Dynamic != "" {
+			return true
+		}
+	}
+	for _, sub := range cmd.Subcommands {
+		if hasDynamic(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandPath names the subcommand reached through path: "remote add".
+func commandPath(path []*model.Command) string {
+	names := make([]string, len(path))
+	for i, c := range path {
+		names[i] = c.Name
+	}
+	return strings.Join(names, " ")
+}
+
+// walkCommands calls fn for cmd and every subcommand below it, parents
+// first, with the path of names leading to each: "prog", "prog remote",
+// "prog remote add". path is the path of cmd.
+func walkCommands(cmd *model.Command, path string, fn func(c *model.Command, path string)) {
+	fn(cmd, path)
+	for _, sub := range cmd.Subcommands {
+		walkCommands(sub, path+" "+sub.Name, fn)
+	}
+}
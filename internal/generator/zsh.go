@@ -14,78 +14,259 @@ func Zsh(cmd *model.Command) string {
 
 	fmt.Fprintf(&b, "#compdef %s\n", name)
 	fmt.Fprintf(&b, "# Zsh completions for %s (generated by theautocompletor)\n\n", name)
-	fmt.Fprintf(&b, "_%s() {\n", name)
-	b.WriteString("    local state\n\n")
+	if hasDynamic(cmd) {
+		// Values of flags with a dynamic source are computed at runtime.
+		fmt.Fprintf(&b, "%s() {\n", zshDynamicFunc(name))
+		b.WriteString("    local -a candidates\n")
+		// The words of this command, saved before _arguments shifts
+		// $words for subcommands.
+		fmt.Fprintf(&b, "    candidates=(${(f)\"$(%s %s \"${(@)%s}\" 2>/dev/null)\"})\n", completeCommand, name, zshWordsVar)
+		fmt.Fprintf(&b, "    [[ ${%[1]s[-1]} == --*=* ]] && candidates=(${candidates#${%[1]s[-1]%%%%=*}=})\n", zshWordsVar)
+		b.WriteString("    candidates=(${candidates//:/\\\\:})\n")
+		b.WriteString("    candidates=(${candidates/$'\\t'/:})\n")
+		b.WriteString("    _describe -t values value candidates\n")
+		b.WriteString("}\n\n")
+	}
+
+	zshCommand(&b, name, cmd, "_"+name, hasDynamic(cmd))
+	fmt.Fprintf(&b, "_%s \"$@\"\n", name)
+	return b.String()
+}
 
-	if len(cmd.Subcommands) > 0 {
+// zshCommand writes the completion function fn for command c of program
+// root, followed by the functions of its subcommands that have subcommands
+// of their own. Inside the "args" state the words are shifted so that
+// $words[1] is the subcommand, which lets every level use the same shape.
+func zshCommand(b *strings.Builder, root string, c *model.Command, fn string, dynamic bool) {
+	fmt.Fprintf(b, "%s() {\n", fn)
+	b.WriteString("    local state\n")
+	if dynamic {
+		// $words only holds this command, not earlier ones on the line
+		// (a && b): the arguments up to the word being completed.
+		fmt.Fprintf(b, "    local -a %s\n", zshWordsVar)
+		fmt.Fprintf(b, "    %s=(\"${(@)words[2,CURRENT]}\")\n", zshWordsVar)
+	}
+	b.WriteString("\n")
+
+	if len(c.Subcommands) == 0 {
 		b.WriteString("    _arguments \\\n")
-		// Root flags
-		for _, f := range cmd.Flags {
-			b.WriteString(zshArg(f))
-		}
-		b.WriteString("        '1:command:->command' \\\n")
-		b.WriteString("        '*::args:->args'\n\n")
-
-		b.WriteString("    case $state in\n")
-		b.WriteString("        command)\n")
-		b.WriteString("            local -a subcommands\n")
-		b.WriteString("            subcommands=(\n")
-		for _, sub := range cmd.Subcommands {
-			fmt.Fprintf(&b, "                '%s:%s'\n", sub.Name, escapeSingleQuote(sub.Description))
-		}
-		b.WriteString("            )\n")
-		b.WriteString("            _describe 'subcommand' subcommands\n")
-		b.WriteString("            ;;\n")
-
-		b.WriteString("        args)\n")
-		b.WriteString("            case $words[1] in\n")
-		for _, sub := range cmd.Subcommands {
-			if len(sub.Flags) == 0 {
-				continue
-			}
-			fmt.Fprintf(&b, "                %s)\n", sub.Name)
-			b.WriteString("                    _arguments \\\n")
-			for _, f := range sub.Flags {
-				b.WriteString(zshArg(f))
-			}
-			b.WriteString("                    ;;\n")
+		for _, f := range c.Flags {
+			b.WriteString(zshArg(root, f))
 		}
-		b.WriteString("            esac\n")
-		b.WriteString("            ;;\n")
-		b.WriteString("    esac\n")
-	} else {
-		b.WriteString("    _arguments \\\n")
-		for _, f := range cmd.Flags {
-			b.WriteString(zshArg(f))
+		for _, spec := range zshPositionals(c.Args) {
+			fmt.Fprintf(b, "        %s \\\n", spec)
 		}
 		b.WriteString("        && return 0\n")
+		b.WriteString("}\n\n")
+		return
 	}
 
-	fmt.Fprintf(&b, "}\n\n_%s \"$@\"\n", name)
-	return b.String()
+	b.WriteString("    _arguments \\\n")
+	for _, f := range c.Flags {
+		b.WriteString(zshArg(root, f))
+	}
+	b.WriteString("        '1:command:->command' \\\n")
+	b.WriteString("        '*::args:->args'\n\n")
+
+	b.WriteString("    case $state in\n")
+	b.WriteString("        command)\n")
+	b.WriteString("            local -a subcommands\n")
+	b.WriteString("            subcommands=(\n")
+	for _, sub := range c.Subcommands {
+		for _, name := range sub.Names() {
+			fmt.Fprintf(b, "                '%s:%s'\n", name, escapeSingleQuote(sub.Description))
+		}
+	}
+	b.WriteString("            )\n")
+	b.WriteString("            _describe 'subcommand' subcommands\n")
+	// The command's own first argument shares the position with its
+	// subcommands.
+	if len(c.Args) > 0 && len(c.Args[0].Choices) > 0 {
+		var choices []string
+		for _, v := range c.Args[0].Choices {
+			choices = append(choices, "'"+escapeSingleQuote(v)+"'")
+		}
+		fmt.Fprintf(b, "            compadd -- %s\n", strings.Join(choices, " "))
+	}
+	b.WriteString("            ;;\n")
+
+	b.WriteString("        args)\n")
+	b.WriteString("            case $words[1] in\n")
+	for _, sub := range c.Subcommands {
+		if len(sub.Subcommands) > 0 {
+			fmt.Fprintf(b, "                %s)\n", strings.Join(sub.Names(), "|"))
+			fmt.Fprintf(b, "                    %s\n", fn+"__"+sub.Name)
+			b.WriteString("                    ;;\n")
+			continue
+		}
+		if len(sub.Flags) == 0 && len(sub.Args) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "                %s)\n", strings.Join(sub.Names(), "|"))
+		b.WriteString("                    _arguments \\\n")
+		for _, f := range sub.Flags {
+			b.WriteString(zshArg(root, f))
+		}
+		for _, spec := range zshPositionals(sub.Args) {
+			fmt.Fprintf(b, "        %s \\\n", spec)
+		}
+		b.WriteString("                    ;;\n")
+	}
+	// Any other first word was the command's first argument: complete the
+	// ones after it, or more of a variadic one.
+	rest := c.Args
+	if len(rest) > 0 && !rest[0].Variadic {
+		rest = rest[1:]
+	}
+	if specs := zshPositionals(rest); len(specs) > 0 {
+		b.WriteString("                *)\n")
+		b.WriteString("                    _arguments \\\n")
+		for _, spec := range specs {
+			fmt.Fprintf(b, "        %s \\\n", spec)
+		}
+		b.WriteString("                    ;;\n")
+	}
+	b.WriteString("            esac\n")
+	b.WriteString("            ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("}\n\n")
+
+	for _, sub := range c.Subcommands {
+		if len(sub.Subcommands) > 0 {
+			zshCommand(b, root, sub, fn+"__"+sub.Name, false)
+		}
+	}
 }
 
-func zshArg(f model.Flag) string {
+// zshArg renders one _arguments spec for a flag of command cmdName.
+func zshArg(cmdName string, f model.Flag) string {
+	names := f.Names()
+	if len(names) == 0 {
+		return ""
+	}
+	action := ""
+	switch {
+	case f.Dynamic != "" && f.TakesArg:
+		action = ":value:" + zshDynamicFunc(cmdName)
+	case f.Dynamic != "" && f.OptionalArg:
+		action = "::value:" + zshDynamicFunc(cmdName)
+	case f.TakesArg && len(f.Values) > 0:
+		action = ":value:" + zshValueList(f.Values)
+	case f.TakesArg:
+		action = ":value:_files"
+	case f.OptionalArg && len(f.Values) > 0:
+		action = "::value:" + zshValueList(f.Values)
+	case f.OptionalArg:
+		action = "::value: "
+	}
+	desc := escapeSingleQuote(flagDescription(f))
+
+	// Spellings as written in the spec, with how the value attaches:
+	// --output=, --color=-, -O-
+	specNames := make([]string, len(names))
+	for i, n := range names {
+		specNames[i] = n + zshValueSuffix(f, n)
+	}
+	negated := f.NegatedName()
+
+	// Exclusion list: the flag's own spellings (unless it may be repeated)
+	// plus every flag it cannot be combined with.
+	var excl []string
+	if !f.Repeatable && (len(names) > 1 || negated != "" || len(f.Excludes) > 0) {
+		excl = append(excl, names...)
+		if negated != "" {
+			excl = append(excl, negated)
+		}
+	}
+	excl = append(excl, f.Excludes...)
+
+	head := ""
+	if len(excl) > 0 {
+		head = "(" + strings.Join(excl, " ") + ")"
+	}
+	if f.Repeatable {
+		head += "*"
+	}
+
 	var spec string
-	if f.Short != "" && f.Long != "" {
-		spec = fmt.Sprintf("'(%s %s)'", f.Short, f.Long)
-		if f.TakesArg {
-			spec += fmt.Sprintf("{%s,%s}[%s]:value:_files", f.Short, f.Long, escapeSingleQuote(f.Description))
-		} else {
-			spec += fmt.Sprintf("{%s,%s}[%s]", f.Short, f.Long, escapeSingleQuote(f.Description))
+	if len(names) > 1 {
+		// '(-u --url)'{-u,--url}'[desc]'
+		if head != "" {
+			spec = "'" + head + "'"
 		}
+		spec += fmt.Sprintf("{%s}'[%s]%s'", strings.Join(specNames, ","), desc, action)
 	} else {
-		flag := f.Long
-		if flag == "" {
-			flag = f.Short
+		spec = fmt.Sprintf("'%s%s[%s]%s'", head, specNames[0], desc, action)
+	}
+	out := fmt.Sprintf("        %s \\\n", spec)
+
+	if negated != "" {
+		out += fmt.Sprintf("        '(%s %s)%s[Negate %s]' \\\n", f.Long, negated, negated, f.Long)
+	}
+	return out
+}
+
+// zshPositionals renders the _arguments specs of positional arguments:
+// '1:service:(web db)', '2::optional file:_files', '*:files:_files'.
+// Nothing follows a variadic argument.
+func zshPositionals(args []model.Arg) []string {
+	var specs []string
+	for i, a := range args {
+		pos := fmt.Sprint(i + 1)
+		if a.Variadic {
+			pos = "*"
+		}
+		if a.Optional {
+			pos += ":"
+		}
+		message := a.Name
+		if a.Description != "" {
+			message += " - " + a.Description
 		}
-		if f.TakesArg {
-			spec = fmt.Sprintf("'%s[%s]:value:_files'", flag, escapeSingleQuote(f.Description))
-		} else {
-			spec = fmt.Sprintf("'%s[%s]'", flag, escapeSingleQuote(f.Description))
+		action := "_files"
+		if len(a.Choices) > 0 {
+			action = zshValueList(a.Choices)
 		}
+		message = strings.ReplaceAll(escapeSingleQuote(message), ":", `\:`)
+		specs = append(specs, fmt.Sprintf("'%s:%s:%s'", pos, message, action))
+		if a.Variadic {
+			break
+		}
+	}
+	return specs
+}
+
+// zshValueSuffix returns the _arguments suffix describing how the value of
+// flag spelling name is written: "=" (--output=FILE or --output FILE),
+// "=-" (only --color=WHEN) or "-" (only attached, -Olevel).
+func zshValueSuffix(f model.Flag, name string) string {
+	long := strings.HasPrefix(name, "--")
+	switch {
+	case f.OptionalArg && long && f.EqualsForm:
+		return "=-"
+	case f.OptionalArg:
+		return "-"
+	case f.TakesArg && long && f.EqualsForm:
+		return "="
+	}
+	return ""
+}
+
+// zshWordsVar holds the arguments on the command line for zshDynamicFunc.
+const zshWordsVar = "theautocompletor_words"
+
+// zshDynamicFunc is the name of the function asking for runtime candidates.
+func zshDynamicFunc(cmdName string) string {
+	return "_" + cmdName + "_dynamic"
+}
+
+// zshValueList renders fixed values as an _arguments action: (auto always never).
+func zshValueList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = escapeSingleQuote(strings.ReplaceAll(v, " ", `\ `))
 	}
-	return fmt.Sprintf("        %s \\\n", spec)
+	return "(" + strings.Join(quoted, " ") + ")"
 }
 
 func escapeSingleQuote(s string) string {
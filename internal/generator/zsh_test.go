@@ -0,0 +1,66 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+func TestZshPositionals(t *testing.T) {
+	script := Zsh(positionalTree())
+	for _, want := range []string{
+		"start|up)",
+		`'1:service:(web db)'`,
+		`'2::mode:(fast slow)'`,
+		`'*:extra:(x y)'`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script lacks %s:\n%s", want, script)
+		}
+	}
+
+	leaf := &model.Command{Name: "leaf", Args: []model.Arg{
+		{Name: "file", Description: "input: a path"},
+		{Name: "rest", Variadic: true},
+		{Name: "ignored"},
+	}}
+	script = Zsh(leaf)
+	for _, want := range []string{`'1:file - input\: a path:_files'`, `'*:rest:_files'`} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script lacks %s:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "ignored") {
+		t.Error("argument after a variadic one emitted")
+	}
+}
+
+func TestZshNested(t *testing.T) {
+	script := Zsh(nestedTree())
+	for _, want := range []string{
+		"compadd -- 'here' 'there'",
+		"                *)\n                    _arguments \\\n        '1:level:(low high)'",
+		"remote)\n                    _demo__remote\n",
+		"_demo__remote() {",
+		"add|new)",
+		`'1:name:(origin upstream)'`,
+		`'2:protocol:(ssh https)'`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script lacks %s:\n%s", want, script)
+		}
+	}
+}
+
+func TestZshDynamicWords(t *testing.T) {
+	root := nestedTree()
+	root.Subcommands[0].Subcommands[0].Flags = []model.Flag{{Long: "--branch", TakesArg: true, Dynamic: "git-branches"}}
+	script := Zsh(root)
+	if !strings.Contains(script, "_demo() {\n    local state\n    local -a theautocompletor_words\n    theautocompletor_words=(\"${(@)words[2,CURRENT]}\")\n") {
+		t.Errorf("_demo does not save its words before _arguments:\n%s", script)
+	}
+	if strings.Contains(script, "LBUFFER") {
+		t.Errorf("dynamic values read the whole buffer:\n%s", script)
+	}
+}
@@ -0,0 +1,238 @@
+// Package hooks writes package manager hooks (pacman, apt) and a systemd
+// user path unit that run theautocompletor refresh when programs change, so
+// installed completions stay current without manual runs.
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Kind is a hook mechanism.
+type Kind string
+
+const (
+	Pacman  Kind = "pacman"
+	Apt     Kind = "apt"
+	Systemd Kind = "systemd"
+)
+
+// Kinds lists every hook mechanism.
+var Kinds = []Kind{Pacman, Apt, Systemd}
+
+// Unit names of the systemd hook.
+const (
+	SystemdPathUnit    = "theautocompletor-refresh.path"
+	systemdServiceUnit = "theautocompletor-refresh.service"
+)
+
+// ParseKind validates a hook mechanism given by the user.
+func ParseKind(s string) (Kind, error) {
+	for _, k := range Kinds {
+		if string(k) == strings.ToLower(s) {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("unknown hook %q (supported: pacman, apt, systemd)", s)
+}
+
+// Detect returns the hook mechanisms available on this system.
+func Detect() []Kind {
+	var kinds []Kind
+	if _, err := exec.LookPath("pacman"); err == nil {
+		kinds = append(kinds, Pacman)
+	}
+	if _, err := exec.LookPath("dpkg"); err == nil {
+		kinds = append(kinds, Apt)
+	}
+	if _, err := exec.LookPath("systemctl"); err == nil {
+		kinds = append(kinds, Systemd)
+	}
+	return kinds
+}
+
+// File is a hook file to write.
+type File struct {
+	Path    string
+	Content string
+}
+
+// Options describes the refresh the hooks run.
+type Options struct {
+	// Binary is the absolute path of theautocompletor.
+	Binary string
+	// User owns the completions to refresh. The pacman and apt hooks run as
+	// root and switch to this user; nil means they refresh root's completions.
+	// The systemd unit always belongs to the current user.
+	User *user.User
+	// Watch lists the directories the systemd path unit watches.
+	Watch []string
+}
+
+// safePath matches paths the hook files can hold as they are: the hooks
+// paste them into pacman Exec lines, apt's double-quoted sh commands and
+// systemd ExecStart lines, which each quote differently.
+var safePath = regexp.MustCompile(`^[A-Za-z0-9/._+@-]+$`)
+
+// Validate checks that the paths and user name in opts can go into hook
+// files unquoted.
+func (opts Options) Validate() error {
+	values := []string{opts.Binary}
+	if u := opts.User; u != nil {
+		values = append(values, u.Username, u.HomeDir)
+	}
+	for _, v := range values {
+		if !safePath.MatchString(v) {
+			return fmt.Errorf("cannot use %q in a hook: only letters, digits and /._+@- are allowed", v)
+		}
+	}
+	return nil
+}
+
+// Files returns the files making up the hook of kind k.
+func Files(k Kind, opts Options) []File {
+	switch k {
+	case Pacman:
+		return []File{{
+			Path:    "/etc/pacman.d/hooks/theautocompletor.hook",
+			Content: pacmanHook(opts),
+		}}
+	case Apt:
+		return []File{{
+			Path:    "/etc/apt/apt.conf.d/80theautocompletor",
+			Content: aptHook(opts),
+		}}
+	case Systemd:
+		dir := systemdUserDir()
+		return []File{
+			{Path: filepath.Join(dir, systemdServiceUnit), Content: systemdService(opts)},
+			{Path: filepath.Join(dir, SystemdPathUnit), Content: systemdPath(opts)},
+		}
+	}
+	return nil
+}
+
+// Write writes f, creating its directory.
+func Write(f File) error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return fmt.Errorf("could not create %s: %w", filepath.Dir(f.Path), err)
+	}
+	if err := os.WriteFile(f.Path, []byte(f.Content), 0o644); err != nil {
+		return fmt.Errorf("could not write %s: %w", f.Path, err)
+	}
+	return nil
+}
+
+// Remove deletes f. A file that is already gone is not an error.
+func Remove(f File) error {
+	if err := os.Remove(f.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not remove %s: %w", f.Path, err)
+	}
+	return nil
+}
+
+// DefaultWatch returns the bin directories the systemd unit watches when
+// none are configured: the ones that exist among /usr/bin, /usr/local/bin
+// and ~/.local/bin.
+func DefaultWatch() []string {
+	candidates := []string{"/usr/bin", "/usr/local/bin"}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, ".local", "bin"))
+	}
+	var dirs []string
+	for _, d := range candidates {
+		if info, err := os.Stat(d); err == nil && info.IsDir() {
+			dirs = append(dirs, d)
+		}
+	}
+	return dirs
+}
+
+// refreshCommand returns the command line system-wide hooks run as root:
+// refresh as the owner of the completions, with their HOME.
+func refreshCommand(opts Options, args ...string) string {
+	command := append([]string{opts.Binary, "refresh"}, args...)
+	if u := opts.User; u != nil && u.Uid != "0" {
+		command = append([]string{"/usr/sbin/runuser", "-u", u.Username, "--", "/usr/bin/env", "HOME=" + u.HomeDir}, command...)
+	}
+	return strings.Join(command, " ")
+}
+
+// pacmanHook passes the changed files on stdin (NeedsTargets) so only the
+// programs of the transaction are considered.
+func pacmanHook(opts Options) string {
+	return `# Generated by theautocompletor hooks install
+[Trigger]
+Operation = Install
+Operation = Upgrade
+Operation = Remove
+Type = Path
+Target = usr/bin/*
+
+[Action]
+Description = Refreshing shell completions (theautocompletor)...
+When = PostTransaction
+Exec = ` + refreshCommand(opts, "--stdin") + `
+NeedsTargets
+`
+}
+
+// aptHook runs a full refresh after every dpkg invocation: unlike pacman's
+// NeedsTargets, dpkg does not tell which files changed, so every installed
+// program is checked, though refresh only regenerates the ones whose binary
+// changed. It never makes apt fail.
+func aptHook(opts Options) string {
+	return `// Generated by theautocompletor hooks install
+DPkg::Post-Invoke { "if [ -x ` + opts.Binary + ` ]; then ` + refreshCommand(opts) + ` || true; fi"; };
+`
+}
+
+func systemdService(opts Options) string {
+	return `# Generated by theautocompletor hooks install
+[Unit]
+Description=Refresh shell completions installed by theautocompletor
+
+[Service]
+Type=oneshot
+# Let package upgrades settle before comparing binaries
+ExecStartPre=/bin/sleep 10
+ExecStart=` + opts.Binary + ` refresh
+`
+}
+
+func systemdPath(opts Options) string {
+	var b strings.Builder
+	b.WriteString(`# Generated by theautocompletor hooks install
+[Unit]
+Description=Watch bin directories for programs with completions from theautocompletor
+
+[Path]
+`)
+	for _, d := range opts.Watch {
+		fmt.Fprintf(&b, "PathChanged=%s\n", d)
+	}
+	b.WriteString("Unit=" + systemdServiceUnit + `
+
+[Install]
+WantedBy=default.target
+`)
+	return b.String()
+}
+
+// systemdUserDir returns where user units are installed:
+// $XDG_CONFIG_HOME/systemd/user, falling back to ~/.config.
+func systemdUserDir() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "systemd", "user")
+}
@@ -0,0 +1,42 @@
+package hooks
+
+import (
+	"os/user"
+	"strings"
+	"testing"
+)
+
+func TestAptHook(t *testing.T) {
+	opts := Options{
+		Binary: "/usr/local/bin/theautocompletor",
+		User:   &user.User{Uid: "1000", Username: "alice", HomeDir: "/home/alice"},
+	}
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := `DPkg::Post-Invoke { "if [ -x /usr/local/bin/theautocompletor ]; then /usr/sbin/runuser -u alice -- /usr/bin/env HOME=/home/alice /usr/local/bin/theautocompletor refresh || true; fi"; };` + "\n"
+	if got := aptHook(opts); !strings.HasSuffix(got, want) {
+		t.Errorf("aptHook =\n%s\nwant it to end with\n%s", got, want)
+	}
+	if got := systemdService(opts); !strings.Contains(got, "\nExecStart=/usr/local/bin/theautocompletor refresh\n") {
+		t.Errorf("systemdService =\n%s", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, binary := range []string{
+		"/home/me/my bin/theautocompletor",
+		`/opt/a"b/theautocompletor`,
+		"/opt/$(reboot)/theautocompletor",
+		"/opt/a;b/theautocompletor",
+		"/opt/100%/theautocompletor",
+	} {
+		if err := (Options{Binary: binary}).Validate(); err == nil {
+			t.Errorf("Validate accepted %q", binary)
+		}
+	}
+	opts := Options{Binary: "/usr/bin/theautocompletor", User: &user.User{Username: "bob", HomeDir: "/home/bob smith"}}
+	if err := opts.Validate(); err == nil {
+		t.Error("Validate accepted a home directory with a space")
+	}
+}
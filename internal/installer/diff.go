@@ -0,0 +1,144 @@
+package installer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffCells bounds the LCS table; beyond it the changed middle of the
+// files is shown as replaced wholesale.
+const maxDiffCells = 4_000_000
+
+// edit is one line of a line diff: ' ' kept, '-' removed, '+' added.
+type edit struct {
+	kind byte
+	text string
+}
+
+// unifiedDiff returns the differences between old and new in unified
+// format, or "" if they are equal.
+func unifiedDiff(oldName, newName, old, new string) string {
+	if old == new {
+		return ""
+	}
+	edits := diffLines(splitLines(old), splitLines(new))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	// oldLine and newLine are the 0-based positions before edits[i]
+	oldLine := make([]int, len(edits)+1)
+	newLine := make([]int, len(edits)+1)
+	for i, e := range edits {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if e.kind != '+' {
+			oldLine[i+1]++
+		}
+		if e.kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(edits); {
+		if edits[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk while changes are close enough to share context
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].kind != ' ' {
+				end = j
+			} else if j-end > 2*diffContext {
+				break
+			}
+		}
+		end = min(end+diffContext+1, len(edits))
+
+		oldCount := oldLine[end] - oldLine[start]
+		newCount := newLine[end] - newLine[start]
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldLine[start], oldCount), hunkRange(newLine[start], newCount))
+		for _, e := range edits[start:end] {
+			fmt.Fprintf(&b, "%c%s\n", e.kind, e.text)
+		}
+		i = end
+	}
+	return b.String()
+}
+
+// hunkRange formats the start and length of a hunk side (1-based start).
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// diffLines computes a line diff from the longest common subsequence, after
+// setting aside the common prefix and suffix.
+func diffLines(a, b []string) []edit {
+	var prefix []edit
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, edit{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	var suffix []edit
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append([]edit{{' ', a[len(a)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	var middle []edit
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, l := range a {
+			middle = append(middle, edit{'-', l})
+		}
+		for _, l := range b {
+			middle = append(middle, edit{'+', l})
+		}
+	} else {
+		// lcs[i][j] is the LCS length of a[i:] and b[j:]
+		n, m := len(a), len(b)
+		lcs := make([][]int32, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && a[i] == b[j]:
+				middle = append(middle, edit{' ', a[i]})
+				i, j = i+1, j+1
+			case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+				middle = append(middle, edit{'-', a[i]})
+				i++
+			default:
+				middle = append(middle, edit{'+', b[j]})
+				j++
+			}
+		}
+	}
+	return append(append(prefix, middle...), suffix...)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
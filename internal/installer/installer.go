@@ -1,40 +1,243 @@
 package installer
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/TerenceU/the-autocompletor/internal/shell"
 )
 
-// completionsFileName returns the correct filename for the given shell.
+// completionsFileName returns the name each shell looks for when loading
+// the completions of program on demand.
 func completionsFileName(sh shell.Shell, program string) string {
 	switch sh {
 	case shell.Zsh:
 		return "_" + program
+	case shell.Bash:
+		return program
 	default:
 		return program + "." + string(sh)
 	}
 }
 
-// Install writes the completion content to the correct directory for the shell.
-func Install(sh shell.Shell, program, content string) (string, error) {
-	dir := shell.CompletionsDir(sh)
+// GeneratedMarker is in the header of every script theautocompletor
+// generates. Files without it are only replaced when forced.
+const GeneratedMarker = "(generated by theautocompletor)"
+
+// ForeignFileError is returned when the file to replace was not generated
+// by theautocompletor: hand-written, or shipped with the program.
+type ForeignFileError struct {
+	Path string
+}
+
+func (e *ForeignFileError) Error() string {
+	return fmt.Sprintf("%s was not generated by theautocompletor (use --force to replace it, a backup is kept)", e.Path)
+}
+
+// Change describes what installing a script would do.
+type Change struct {
+	Path    string
+	Exists  bool
+	Foreign bool   // the existing file was not generated by theautocompletor
+	Diff    string // unified diff from the existing file, "" if unchanged
+}
+
+// Target returns the path the completions of program are installed to in
+// dir, or in the shell's per-user completions directory if dir is empty.
+func Target(sh shell.Shell, dir, program string) (string, error) {
+	if dir == "" {
+		dir = shell.CompletionsDir(sh)
+	}
 	if dir == "" {
 		return "", fmt.Errorf("unknown install directory for shell %q", sh)
 	}
+	return filepath.Join(dir, completionsFileName(sh, filepath.Base(program))), nil
+}
 
+// Plan compares content with the file at path, without writing anything.
+func Plan(path, content string) (Change, error) {
+	c := Change{Path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.Diff = unifiedDiff("/dev/null", path, "", content)
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	c.Exists = true
+	c.Foreign = !generated(data)
+	c.Diff = unifiedDiff(path, path, string(data), content)
+	return c, nil
+}
+
+// Install writes the completion content for program to dir (see Target) and
+// returns the path, and the backup made of a replaced foreign file, if any.
+func Install(sh shell.Shell, dir, program, content string, force bool) (path, backup string, err error) {
+	path, err = Target(sh, dir, program)
+	if err != nil {
+		return "", "", err
+	}
+	backup, err = InstallTo(path, content, force)
+	if err != nil {
+		return "", "", err
+	}
+	return path, backup, nil
+}
+
+// InstallTo atomically replaces the file at path with content. A file not
+// generated by theautocompletor is only replaced if force is set, after it
+// is copied to BackupDir; the backup path is returned.
+func InstallTo(path, content string, force bool) (string, error) {
+	var backup string
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil && !generated(data):
+		if !force {
+			return "", &ForeignFileError{Path: path}
+		}
+		if backup, err = backupFile(path, data); err != nil {
+			return "", err
+		}
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return "", fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return "", fmt.Errorf("could not create completions directory %q: %w", dir, err)
 	}
+	if err := writeAtomic(path, []byte(content)); err != nil {
+		return "", fmt.Errorf("could not write completions file: %w", err)
+	}
+	return backup, nil
+}
 
-	fileName := completionsFileName(sh, program)
-	path := filepath.Join(dir, fileName)
+// Generated reports whether the file at path was written by theautocompletor.
+func Generated(path string) bool {
+	data, err := os.ReadFile(path)
+	return err == nil && generated(data)
+}
 
-	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
-		return "", fmt.Errorf("could not write completions file: %w", err)
+// generated reports whether a file starts with the header of a generated script.
+func generated(data []byte) bool {
+	return bytes.Contains(data[:min(len(data), 512)], []byte(GeneratedMarker))
+}
+
+// BackupDir returns where replaced files are kept:
+// $XDG_DATA_HOME/theautocompletor/backups, falling back to ~/.local/share.
+// Backups can't stay next to the originals: zsh would load _git.bak as a
+// completion function.
+func BackupDir() string {
+	return filepath.Join(dataDir(), "backups")
+}
+
+// backupFile copies data, the content of path, to BackupDir under a
+// timestamped name.
+func backupFile(path string, data []byte) (string, error) {
+	dir := BackupDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("could not create backup directory: %w", err)
+	}
+	backup := filepath.Join(dir, filepath.Base(path)+"."+time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(backup, data, 0o644); err != nil {
+		return "", fmt.Errorf("could not back up %s: %w", path, err)
+	}
+	return backup, nil
+}
+
+// writeAtomic writes data to a temporary file next to path and renames it
+// over path, so a shell never loads a half-written script.
+func writeAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
 	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// systemDirs are searched by Existing for completion scripts shipped with
+// programs, installed by other tools or by older versions of this one.
+// Entries are glob patterns; "~" is the home directory.
+var systemDirs = map[shell.Shell][]string{
+	shell.Bash: {
+		"~/.bash_completion.d",
+		"/usr/local/share/bash-completion/completions",
+		"/usr/share/bash-completion/completions",
+		"/etc/bash_completion.d",
+	},
+	shell.Zsh: {
+		"~/.zsh/completions",
+		"/usr/local/share/zsh/site-functions",
+		"/usr/share/zsh/site-functions",
+		"/usr/share/zsh/vendor-completions",
+		"/usr/share/zsh/functions/Completion/*",
+		"/usr/share/zsh/*/functions/Completion/*",
+	},
+	shell.Fish: {
+		"~/.config/fish/completions",
+		"/etc/fish/completions",
+		"/usr/local/share/fish/vendor_completions.d",
+		"/usr/share/fish/vendor_completions.d",
+		"/usr/local/share/fish/completions",
+		"/usr/share/fish/completions",
+	},
+}
 
-	return path, nil
+// Existing returns the path of a completion script for program that is
+// already installed for sh, ours or another one, or "" if there is none.
+func Existing(sh shell.Shell, program string) string {
+	if paths := ExistingAll(sh, program); len(paths) > 0 {
+		return paths[0]
+	}
+	return ""
+}
+
+// ExistingAll returns every completion script for program installed for
+// sh, in the order Existing searches them.
+func ExistingAll(sh shell.Shell, program string) []string {
+	program = filepath.Base(program)
+	dirs := append([]string{shell.CompletionsDir(sh)}, systemDirs[sh]...)
+	names := []string{completionsFileName(sh, program)}
+	if sh == shell.Bash {
+		names = append(names, program+".bash", "_"+program)
+	}
+	home, _ := os.UserHomeDir()
+	var paths []string
+	for _, pattern := range dirs {
+		if rest, ok := strings.CutPrefix(pattern, "~"); ok {
+			if home == "" {
+				continue
+			}
+			pattern = home + rest
+		}
+		for _, name := range names {
+			matches, _ := filepath.Glob(filepath.Join(pattern, name))
+			for _, m := range matches {
+				if !slices.Contains(paths, m) {
+					paths = append(paths, m)
+				}
+			}
+		}
+	}
+	return paths
 }
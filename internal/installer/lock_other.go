@@ -0,0 +1,9 @@
+//go:build !unix
+
+package installer
+
+// lockFile is a no-op where flock isn't available; concurrent updates of the
+// manifest may then lose entries.
+func lockFile(path string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,246 @@
+package installer
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/TerenceU/the-autocompletor/internal/shell"
+)
+
+// Entry records one installed completion script.
+type Entry struct {
+	Program     string      `json:"program"`
+	Shell       shell.Shell `json:"shell"`
+	Path        string      `json:"path"`
+	Binary      string      `json:"binary,omitempty"`
+	BinaryHash  string      `json:"binary_hash,omitempty"`
+	Version     string      `json:"version"`
+	InstalledAt time.Time   `json:"installed_at"`
+	Origin      string      `json:"origin,omitempty"` // set if the script was not parsed from the program
+}
+
+// Origins of scripts that refresh cannot regenerate by parsing the program
+// again.
+const (
+	OriginAI       = "ai"        // made by the AI fallback
+	OriginHelpFile = "help-file" // parsed from --help-file or --man-file
+)
+
+// Status is the state of an installed script relative to the program.
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusOutdated Status = "outdated"   // the program binary changed since install
+	StatusMissing  Status = "missing"    // the script was deleted
+	StatusOrphaned Status = "no-program" // the program is no longer installed
+	StatusUnknown  Status = "unknown"    // no binary was recorded (e.g. --help-file)
+)
+
+// Manifest lists the completion scripts installed by theautocompletor.
+type Manifest struct {
+	Entries []Entry `json:"entries"`
+}
+
+// ManifestPath returns the location of the install manifest:
+// $XDG_DATA_HOME/theautocompletor/installed.json, falling back to ~/.local/share.
+func ManifestPath() string {
+	return filepath.Join(dataDir(), "installed.json")
+}
+
+// dataDir returns $XDG_DATA_HOME/theautocompletor, falling back to ~/.local/share.
+func dataDir() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "theautocompletor")
+}
+
+// LoadManifest reads the install manifest. A missing manifest is empty.
+func LoadManifest() (*Manifest, error) {
+	m := &Manifest{}
+	data, err := os.ReadFile(ManifestPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read install manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", ManifestPath(), err)
+	}
+	return m, nil
+}
+
+// save writes the manifest back to disk. The file is replaced in one step,
+// so readers never see it half written. Writers go through UpdateManifest.
+func (m *Manifest) save() error {
+	path := ManifestPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("could not create manifest directory: %w", err)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("could not write install manifest: %w", err)
+	}
+	return nil
+}
+
+// UpdateManifest loads the manifest, applies update and saves it, holding a
+// lock on the manifest file meanwhile so that concurrent runs (e.g. several
+// background generations started by the init hooks) don't drop each
+// other's entries.
+func UpdateManifest(update func(m *Manifest)) error {
+	path := ManifestPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("could not create manifest directory: %w", err)
+	}
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return fmt.Errorf("could not lock install manifest: %w", err)
+	}
+	defer unlock()
+	m, err := LoadManifest()
+	if err != nil {
+		return err
+	}
+	update(m)
+	return m.save()
+}
+
+// Put adds e, replacing the entry for the same program and shell.
+func (m *Manifest) Put(e Entry) {
+	m.Remove(e.Program, e.Shell)
+	m.Entries = append(m.Entries, e)
+	slices.SortFunc(m.Entries, func(a, b Entry) int {
+		return cmp.Or(cmp.Compare(a.Program, b.Program), cmp.Compare(a.Shell, b.Shell))
+	})
+}
+
+// Remove drops the entries of program, for sh only unless sh is empty, and
+// returns them.
+func (m *Manifest) Remove(program string, sh shell.Shell) []Entry {
+	var removed []Entry
+	m.Entries = slices.DeleteFunc(m.Entries, func(e Entry) bool {
+		if e.Program == program && (sh == "" || e.Shell == sh) {
+			removed = append(removed, e)
+			return true
+		}
+		return false
+	})
+	return removed
+}
+
+// Find returns the entries of program (all of them if program is empty).
+func (m *Manifest) Find(program string) []Entry {
+	var out []Entry
+	for _, e := range m.Entries {
+		if program == "" || e.Program == program {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Record adds the script installed at path to the manifest file, along with
+// the hash of the program binary it was generated from. origin is empty if
+// the script was parsed from the program, see OriginAI and OriginHelpFile.
+func Record(sh shell.Shell, program, path, version, origin string) error {
+	return UpdateManifest(func(m *Manifest) {
+		m.Record(sh, program, path, version, origin)
+	})
+}
+
+// Record adds the script installed at path to m, along with the hash of the
+// program binary it was generated from.
+func (m *Manifest) Record(sh shell.Shell, program, path, version, origin string) {
+	e := Entry{
+		Program:     filepath.Base(program),
+		Shell:       sh,
+		Path:        path,
+		Version:     version,
+		InstalledAt: time.Now().UTC().Truncate(time.Second),
+		Origin:      origin,
+	}
+	if bin, err := exec.LookPath(program); err == nil {
+		if abs, err := filepath.Abs(bin); err == nil {
+			bin = abs
+		}
+		e.Binary = bin
+		e.BinaryHash, _ = hashFile(bin)
+	}
+	m.Put(e)
+}
+
+// Refreshable reports whether refresh can regenerate the script of e by
+// parsing the program again: not if it was made by AI or from help files,
+// nor if no program binary was recorded to tell when it changes.
+func (e Entry) Refreshable() bool {
+	return e.Origin == "" && e.Binary != "" && e.BinaryHash != ""
+}
+
+// Check compares e with the script on disk and the program binary.
+func (e Entry) Check() Status {
+	if _, err := os.Stat(e.Path); err != nil {
+		return StatusMissing
+	}
+	if e.Binary == "" || e.BinaryHash == "" {
+		return StatusUnknown
+	}
+	hash, err := hashFile(e.Binary)
+	if err != nil {
+		// The program may have moved to another directory
+		bin, lookErr := exec.LookPath(e.Program)
+		if lookErr != nil {
+			return StatusOrphaned
+		}
+		if hash, err = hashFile(bin); err != nil {
+			return StatusOrphaned
+		}
+	}
+	if hash != e.BinaryHash {
+		return StatusOutdated
+	}
+	return StatusOK
+}
+
+// Uninstall deletes the script of e. A script that is already gone is not an error.
+func Uninstall(e Entry) error {
+	if err := os.Remove(e.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not remove %s: %w", e.Path, err)
+	}
+	return nil
+}
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,91 @@
+package installer
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TerenceU/the-autocompletor/internal/shell"
+)
+
+// TestRecordConcurrent records from many goroutines at once, like several
+// background generations started by the init hooks, and expects every
+// entry to survive.
+func TestRecordConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dir)
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			program := fmt.Sprintf("prog%02d", i)
+			errs <- Record(shell.Bash, program, filepath.Join(dir, program), "test", "")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := LoadManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != n {
+		t.Errorf("manifest has %d entries, want %d", len(m.Entries), n)
+	}
+}
+
+// TestUpdateManifestConcurrent runs a long update, like refresh removing
+// and re-recording entries, while another process records a new install:
+// neither loses the other's changes.
+func TestUpdateManifestConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dir)
+	for _, program := range []string{"gone", "kept"} {
+		if err := Record(shell.Bash, program, filepath.Join(dir, program), "test", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	started := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- UpdateManifest(func(m *Manifest) {
+			close(started)
+			time.Sleep(50 * time.Millisecond) // the other writer waits meanwhile
+			m.Remove("gone", shell.Bash)
+			m.Record(shell.Bash, "kept", filepath.Join(dir, "kept"), "refreshed", "")
+		})
+	}()
+	<-started
+	if err := Record(shell.Zsh, "new", filepath.Join(dir, "_new"), "test", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Find("gone")) != 0 {
+		t.Error("removed entry is back")
+	}
+	if kept := m.Find("kept"); len(kept) != 1 || kept[0].Version != "refreshed" {
+		t.Errorf("kept = %+v, want the refreshed entry", kept)
+	}
+	if len(m.Find("new")) != 1 {
+		t.Error("entry recorded during the update was lost")
+	}
+}
@@ -0,0 +1,205 @@
+// Package lazy provides the shell hooks that generate completions on the
+// first TAB for commands that have none (theautocompletor init <shell>), and
+// the bookkeeping of the background generations they start.
+package lazy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/TerenceU/the-autocompletor/internal/shell"
+)
+
+// staleLock is how old a lock may get before it is assumed to belong to a
+// generation that died.
+const staleLock = 10 * time.Minute
+
+// ErrRunning is returned by Lock while another generation for the same
+// program is in progress.
+var ErrRunning = errors.New("generation already in progress")
+
+// StateDir returns the directory holding locks and failure markers:
+// $XDG_CACHE_HOME/theautocompletor/lazy, falling back to ~/.cache.
+func StateDir() string {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(dir, "theautocompletor", "lazy")
+}
+
+// Lock marks a generation for program as running and returns the function
+// that releases it. It fails with ErrRunning if one is already running.
+func Lock(program string) (func(), error) {
+	dir := StateDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, filepath.Base(program)+".lock")
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLock {
+		os.Remove(path)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, ErrRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(f, os.Getpid())
+	f.Close()
+	return func() { os.Remove(path) }, nil
+}
+
+// MarkFailed records that completions for program could not be generated,
+// so the hooks stop retrying on every TAB. Removing the marker (or running
+// theautocompletor on the program directly) allows a new attempt.
+func MarkFailed(program string) {
+	dir := StateDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return
+	}
+	os.WriteFile(failedPath(program), nil, 0o644)
+}
+
+// ClearFailed removes the failure marker of program, if any.
+func ClearFailed(program string) {
+	os.Remove(failedPath(program))
+}
+
+// Failed returns the programs whose generation failed, in name order.
+func Failed() []string {
+	matches, _ := filepath.Glob(filepath.Join(StateDir(), "*.failed"))
+	programs := make([]string, 0, len(matches))
+	for _, m := range matches {
+		programs = append(programs, strings.TrimSuffix(filepath.Base(m), ".failed"))
+	}
+	return programs
+}
+
+func failedPath(program string) string {
+	return filepath.Join(StateDir(), filepath.Base(program)+".failed")
+}
+
+// Snippet returns the init code for sh, to be evaluated by the user's shell
+// startup file. completionsDir is where generated scripts are installed.
+func Snippet(sh shell.Shell, completionsDir string) (string, error) {
+	var tmpl string
+	switch sh {
+	case shell.Bash:
+		tmpl = bashSnippet
+	case shell.Zsh:
+		tmpl = zshSnippet
+	case shell.Fish:
+		tmpl = fishSnippet
+	default:
+		return "", fmt.Errorf("no init hook for shell %q", sh)
+	}
+	return strings.NewReplacer(
+		"@COMPLETIONS@", shellQuote(completionsDir),
+		"@STATE@", shellQuote(StateDir()),
+	).Replace(tmpl), nil
+}
+
+// shellQuote single-quotes s for bash, zsh and fish.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// bashSnippet installs a default completion handler (complete -D, bash 4.1+).
+// Installed scripts are sourced; otherwise bash-completion's loader gets its
+// turn, and if it has nothing a background generation is started while the
+// current TAB falls back to file names.
+const bashSnippet = `# theautocompletor: generate completions on first TAB
+# Add to ~/.bashrc: eval "$(theautocompletor init bash)"
+_theautocompletor_lazy() {
+    local cmd=${1##*/}
+    local file=@COMPLETIONS@/$cmd
+    if [[ -f $file ]]; then
+        . "$file" && return 124
+    fi
+    local loader
+    for loader in _comp_complete_load _completion_loader; do
+        if declare -F "$loader" >/dev/null; then
+            "$loader" "$@"
+            local spec
+            spec=$(complete -p -- "$cmd" 2>/dev/null)
+            if [[ -n $spec && $spec != *_minimal* && $spec != *_comp_complete_minimal* ]]; then
+                return 124
+            fi
+            complete -r -- "$cmd" 2>/dev/null
+            break
+        fi
+    done
+    if type -P -- "$cmd" >/dev/null && [[ ! -e @STATE@/$cmd.failed ]]; then
+        (theautocompletor __lazy bash "$cmd" >/dev/null 2>&1 &)
+    fi
+    compopt -o default 2>/dev/null
+    COMPREPLY=()
+}
+complete -D -F _theautocompletor_lazy
+`
+
+// zshSnippet registers a handler for the -default- context, used for
+// commands without a completion function. Requires compinit to have run.
+const zshSnippet = `# theautocompletor: generate completions on first TAB
+# Add to ~/.zshrc after compinit: eval "$(theautocompletor init zsh)"
+_theautocompletor_lazy() {
+    local cmd=${words[1]:t}
+    local file=@COMPLETIONS@/_$cmd
+    if [[ -f $file ]]; then
+        # Defines _$cmd and completes the current word with it
+        source "$file"
+        compdef "_$cmd" "$cmd"
+        return
+    fi
+    if (( $+commands[$cmd] )) && [[ ! -e @STATE@/$cmd.failed ]]; then
+        (theautocompletor __lazy zsh "$cmd" &>/dev/null &)
+    fi
+    _default "$@"
+}
+compdef _theautocompletor_lazy -default-
+`
+
+// fishSnippet wraps the TAB binding: fish has no hook for commands without
+// completions, so before completing it checks the command on the line and
+// starts a background generation if no completion file exists for it.
+const fishSnippet = `# theautocompletor: generate completions on first TAB
+# Add to ~/.config/fish/config.fish: theautocompletor init fish | source
+function __theautocompletor_lazy
+    set -l tokens (commandline -opc)
+    if test (count $tokens) -gt 0
+        set -l cmd (string replace -r '.*/' '' -- $tokens[1])
+        set -l file @COMPLETIONS@/$cmd.fish
+        if test -f $file
+            if not complete -c $cmd | string length -q
+                source $file
+            end
+        else if type -q -f -- $cmd; and not test -e @STATE@/$cmd.failed
+            set -l found
+            for dir in $fish_complete_path
+                if test -f $dir/$cmd.fish
+                    set found 1
+                    break
+                end
+            end
+            if test -z "$found"
+                theautocompletor __lazy fish $cmd >/dev/null 2>&1 &
+                disown 2>/dev/null
+            end
+        end
+    end
+    commandline -f complete
+end
+bind \t __theautocompletor_lazy
+bind -M insert \t __theautocompletor_lazy 2>/dev/null
+`
@@ -1,26 +1,83 @@
 // Package model defines the shared data structures used across parsers and generators.
 package model
 
+import "strings"
+
+// Source identifies where a flag or subcommand was discovered.
+type Source string
+
+const (
+	SourceMan      Source = "man"      // man page
+	SourceHelp     Source = "--help"   // help output of the program
+	SourceAI       Source = "ai"       // AI fallback
+	SourceNative   Source = "native"   // completion script already installed on the system
+	SourceOverride Source = "override" // per-program overrides file
+)
+
 // Flag represents a single CLI flag with its metadata.
 type Flag struct {
-	Short       string // e.g. "-u"
-	Long        string // e.g. "--url"
+	Short       string   // e.g. "-u"
+	Long        string   // e.g. "--url"
+	Old         string   // e.g. "-verbose" (single-dash long option: Go flag package, X11, Java)
+	Aliases     []string // further spellings, e.g. "--yes" in "-f, --force, --yes"
 	Description string
-	TakesArg    bool // true if the flag requires a value
+	TakesArg    bool     // true if the flag requires a value
+	OptionalArg bool     // true if the value is optional and must be attached: --color[=WHEN], -O[level]
+	EqualsForm  bool     // true if the value is written with "=": --output=FILE, --color[=WHEN]
+	Default     string   // e.g. "info" from `(default "info")` or `[default: info]`
+	Env         string   // e.g. "APP_PORT" from `[env: APP_PORT=]`
+	Values      []string // fixed values the flag accepts, e.g. auto, always, never
+	Dynamic     string   // shell command printing the values at completion time, one per line ("value\tdescription")
+	Negatable   bool     // true if a --no-<long> form exists (git-style --[no-]flag)
+	Repeatable  bool     // true if the flag may be given several times (-v -v, --include a --include b)
+	Excludes    []string // spellings of flags that cannot be used together with this one
+	Source      Source   // where the flag was found
+	Line        string   // raw line the flag was parsed from
+	Confidence  float64  // 0..1, how sure the parser is that this is a real flag
+}
+
+// Names returns every spelling of the flag, e.g. ["-u", "--url"].
+func (f Flag) Names() []string {
+	var names []string
+	for _, n := range []string{f.Short, f.Long, f.Old} {
+		if n != "" {
+			names = append(names, n)
+		}
+	}
+	return append(names, f.Aliases...)
+}
+
+// NegatedName returns the --no-<long> spelling of a negatable flag, or "".
+func (f Flag) NegatedName() string {
+	if !f.Negatable || f.Long == "" {
+		return ""
+	}
+	return "--no-" + strings.TrimPrefix(f.Long, "--")
 }
 
 // Arg represents a positional argument with its metadata.
 type Arg struct {
-	Name        string // e.g. "min-len"
-	Description string // e.g. "Minimum length of generated strings (integer)"
-	Optional    bool   // true if wrapped in [...] in SYNOPSIS
+	Name        string   // e.g. "min-len"
+	Description string   // e.g. "Minimum length of generated strings (integer)"
+	Optional    bool     // true if wrapped in [...] in SYNOPSIS or usage line
+	Variadic    bool     // true if the argument may be repeated (FILE..., [ARGS]...)
+	Choices     []string // fixed values from alternations like {start|stop}
 }
 
 // Command represents a CLI command (root or subcommand) and its tree.
 type Command struct {
 	Name        string
+	Aliases     []string // other names for the same command, e.g. "remove" for "rm"
 	Description string
 	Flags       []Flag
 	Args        []Arg // positional arguments in order
 	Subcommands []*Command
+	Source      Source  // where the command was found
+	Line        string  // raw line the command was listed on in its parent's output
+	Confidence  float64 // 0..1, how sure the parser is that this is a real subcommand
+}
+
+// Names returns the command name followed by its aliases.
+func (c *Command) Names() []string {
+	return append([]string{c.Name}, c.Aliases...)
 }
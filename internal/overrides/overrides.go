@@ -0,0 +1,288 @@
+// Package overrides applies per-program quirks and fixes on top of a parsed
+// command tree. Overrides are declared in JSON keyed by program name: a set
+// of defaults ships with the binary and the user's overrides.json replaces
+// entries for the same program.
+package overrides
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+//go:embed defaults.json
+var defaultsJSON []byte
+
+// Override describes the fixes for a program or one of its subcommands.
+type Override struct {
+	// HelpStrategy is the ordered list of help strategies to try (--help, -h, help, -help).
+	HelpStrategy []string `json:"help_strategy,omitempty"`
+	// MaxDepth limits how many levels of subcommands are probed (at least 1).
+	MaxDepth int `json:"max_depth,omitempty"`
+	// IgnoreSubcommands lists subcommand paths, e.g. "stash drop", that are
+	// never probed and are left out of the completions.
+	IgnoreSubcommands []string `json:"ignore_subcommands,omitempty"`
+	// AddFlags are added, or merged into an existing flag with the same spelling.
+	AddFlags []Flag `json:"add_flags,omitempty"`
+	// RemoveFlags lists spellings of flags to drop, e.g. "--help".
+	RemoveFlags []string `json:"remove_flags,omitempty"`
+	// Values maps a flag spelling to the fixed values it accepts.
+	Values map[string][]string `json:"values,omitempty"`
+	// Dynamic maps a flag spelling to a shell command printing its values at
+	// completion time, one per line, e.g. "git branch --format=%(refname:short)".
+	Dynamic map[string]string `json:"dynamic,omitempty"`
+	// Descriptions maps a flag spelling or subcommand name to a new description.
+	Descriptions map[string]string `json:"descriptions,omitempty"`
+	// Subcommands holds overrides for subcommands, keyed by name.
+	Subcommands map[string]*Override `json:"subcommands,omitempty"`
+}
+
+// Flag is a flag declared in an overrides file.
+type Flag struct {
+	Short       string   `json:"short,omitempty"`
+	Long        string   `json:"long,omitempty"`
+	Old         string   `json:"old,omitempty"`
+	Description string   `json:"description,omitempty"`
+	TakesArg    bool     `json:"takes_arg,omitempty"`
+	Values      []string `json:"values,omitempty"`
+	Dynamic     string   `json:"dynamic,omitempty"`
+}
+
+// Set maps program names to their overrides.
+type Set map[string]*Override
+
+// UserPath returns the location of the user's overrides file:
+// $XDG_CONFIG_HOME/theautocompletor/overrides.json, falling back to ~/.config.
+func UserPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "theautocompletor", "overrides.json")
+}
+
+// Load returns the shipped defaults merged with the user's overrides file.
+// An entry in the user's file replaces the shipped entry for that program.
+// A missing user file is not an error.
+func Load() (Set, error) {
+	set, err := decode(defaultsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("shipped overrides: %w", err)
+	}
+
+	path := UserPath()
+	if path == "" {
+		return set, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return set, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read overrides: %w", err)
+	}
+	user, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, o := range user {
+		set[name] = o
+	}
+	return set, nil
+}
+
+// decode parses an overrides file, rejecting unknown keys so typos don't
+// go unnoticed.
+func decode(data []byte) (Set, error) {
+	set := Set{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// For returns the overrides for program (matched by base name), or nil.
+func (s Set) For(program string) *Override {
+	return s[filepath.Base(program)]
+}
+
+// IgnoredPaths returns every ignored subcommand path relative to the
+// program, including the ones declared under nested subcommand overrides.
+func (o *Override) IgnoredPaths() []string {
+	if o == nil {
+		return nil
+	}
+	var paths []string
+	for _, p := range o.IgnoreSubcommands {
+		paths = append(paths, strings.Join(strings.Fields(p), " "))
+	}
+	for name, sub := range o.Subcommands {
+		for _, p := range sub.IgnoredPaths() {
+			paths = append(paths, name+" "+p)
+		}
+	}
+	return paths
+}
+
+// Apply edits cmd in place according to o. A nil o leaves cmd unchanged.
+func Apply(cmd *model.Command, o *Override) {
+	if o == nil {
+		return
+	}
+
+	for _, p := range o.IgnoreSubcommands {
+		removeSubcommand(cmd, strings.Fields(p))
+	}
+
+	cmd.Flags = slices.DeleteFunc(cmd.Flags, func(f model.Flag) bool {
+		for _, n := range append(f.Names(), f.NegatedName()) {
+			if n != "" && slices.Contains(o.RemoveFlags, n) {
+				return true
+			}
+		}
+		return false
+	})
+
+	for _, af := range o.AddFlags {
+		addFlag(cmd, af)
+	}
+
+	for name, values := range o.Values {
+		if i := findFlag(cmd.Flags, name); i >= 0 {
+			setValues(&cmd.Flags[i], values)
+		}
+	}
+
+	for name, command := range o.Dynamic {
+		if i := findFlag(cmd.Flags, name); i >= 0 {
+			setDynamic(&cmd.Flags[i], command)
+		}
+	}
+
+	for name, desc := range o.Descriptions {
+		if i := findFlag(cmd.Flags, name); i >= 0 {
+			cmd.Flags[i].Description = desc
+		} else if sub := findSubcommand(cmd, name); sub != nil {
+			sub.Description = desc
+		}
+	}
+
+	for name, subOverride := range o.Subcommands {
+		if sub := findSubcommand(cmd, name); sub != nil {
+			Apply(sub, subOverride)
+		}
+	}
+}
+
+// addFlag appends af to cmd, or fills in the flag that already has one of its spellings.
+func addFlag(cmd *model.Command, af Flag) {
+	i := -1
+	for _, n := range []string{af.Short, af.Long, af.Old} {
+		if n != "" && i < 0 {
+			i = findFlag(cmd.Flags, n)
+		}
+	}
+	if i < 0 {
+		cmd.Flags = append(cmd.Flags, model.Flag{
+			Short:       af.Short,
+			Long:        af.Long,
+			Old:         af.Old,
+			Description: af.Description,
+			TakesArg:    af.TakesArg,
+			Source:      model.SourceOverride,
+			Confidence:  1,
+		})
+		i = len(cmd.Flags) - 1
+	} else {
+		f := &cmd.Flags[i]
+		if f.Short == "" {
+			f.Short = af.Short
+		}
+		if f.Long == "" {
+			f.Long = af.Long
+		}
+		if f.Old == "" {
+			f.Old = af.Old
+		}
+		if af.Description != "" {
+			f.Description = af.Description
+		}
+		if af.TakesArg && !f.OptionalArg {
+			f.TakesArg = true
+		}
+	}
+	if len(af.Values) > 0 {
+		setValues(&cmd.Flags[i], af.Values)
+	}
+	if af.Dynamic != "" {
+		setDynamic(&cmd.Flags[i], af.Dynamic)
+	}
+}
+
+// setValues gives f a fixed list of values; a flag with values takes an
+// argument unless its value is optional.
+func setValues(f *model.Flag, values []string) {
+	f.Values = values
+	if !f.OptionalArg {
+		f.TakesArg = true
+	}
+}
+
+// setDynamic gives f a command producing its values at completion time.
+func setDynamic(f *model.Flag, command string) {
+	f.Dynamic = command
+	if !f.OptionalArg {
+		f.TakesArg = true
+	}
+}
+
+// findFlag returns the index of the flag spelled name, or -1.
+func findFlag(flags []model.Flag, name string) int {
+	for i, f := range flags {
+		if slices.Contains(f.Names(), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// findSubcommand returns the direct subcommand of cmd called name (or aliased to it).
+func findSubcommand(cmd *model.Command, name string) *model.Command {
+	for _, sub := range cmd.Subcommands {
+		if slices.Contains(sub.Names(), name) {
+			return sub
+		}
+	}
+	return nil
+}
+
+// removeSubcommand drops the subcommand at path (e.g. ["stash", "drop"]) from cmd.
+func removeSubcommand(cmd *model.Command, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	if len(path) > 1 {
+		if sub := findSubcommand(cmd, path[0]); sub != nil {
+			removeSubcommand(sub, path[1:])
+		}
+		return
+	}
+	cmd.Subcommands = slices.DeleteFunc(cmd.Subcommands, func(c *model.Command) bool {
+		return slices.Contains(c.Names(), path[0])
+	})
+}
@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+// lowConfidence is the score below which the report flags an entry as suspicious.
+const lowConfidence = 0.5
+
+// Diagnostics collects what the extractors did with each candidate line of
+// help and man output, so a parse can be explained (--explain).
+// It is safe for concurrent use.
+type Diagnostics struct {
+	mu      sync.Mutex
+	Entries []Diagnostic
+}
+
+// Diagnostic records the fate of a single candidate line.
+type Diagnostic struct {
+	Command  string       // command path, e.g. "git remote"
+	Source   model.Source // where the line came from
+	Kind     string       // "flag" or "subcommand"
+	Line     string       // the raw line
+	Accepted bool
+	Reason   string // why the line was rejected
+}
+
+func (d *Diagnostics) add(e Diagnostic) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Entries = append(d.Entries, e)
+}
+
+// lineLog records accepted and rejected lines for one command and source.
+// A nil *lineLog (or one without Diagnostics) discards everything.
+type lineLog struct {
+	diag    *Diagnostics
+	command string
+	source  model.Source
+}
+
+func (d *Diagnostics) log(command string, source model.Source) *lineLog {
+	if d == nil {
+		return nil
+	}
+	return &lineLog{diag: d, command: command, source: source}
+}
+
+func (l *lineLog) accept(kind, line string) {
+	if l == nil {
+		return
+	}
+	l.diag.add(Diagnostic{Command: l.command, Source: l.source, Kind: kind, Line: line, Accepted: true})
+}
+
+func (l *lineLog) reject(kind, line, reason string) {
+	if l == nil {
+		return
+	}
+	l.diag.add(Diagnostic{Command: l.command, Source: l.source, Kind: kind, Line: line, Reason: reason})
+}
+
+// flagConfidence scores how sure we are that a help line really declares the flag.
+func flagConfidence(f model.Flag) float64 {
+	c := 0.5
+	if f.Long != "" {
+		c += 0.2 // --long spellings are rarely false positives
+	}
+	if f.Short != "" {
+		c += 0.1
+	}
+	if f.Description != "" {
+		c += 0.15
+	}
+	if f.Short == "" && f.Long == "" {
+		c -= 0.1 // a lone -word may be a stray token from prose
+	}
+	return min(c, 1)
+}
+
+// WriteReport prints the parsed tree with the source, confidence and raw line
+// of every flag and subcommand, followed by the lines the extractors rejected.
+// diag may be nil (e.g. when the tree came from the AI fallback).
+func WriteReport(w io.Writer, cmd *model.Command, diag *Diagnostics) {
+	fmt.Fprintf(w, "== Parse report for %q ==\n", cmd.Name)
+
+	var flags, subs, low int
+	var walk func(c *model.Command, path string)
+	walk = func(c *model.Command, path string) {
+		fmt.Fprintf(w, "\n%s%s\n", path, reportOrigin(c.Source, c.Confidence, c.Line))
+		for _, f := range c.Flags {
+			flags++
+			if f.Confidence < lowConfidence {
+				low++
+			}
+			fmt.Fprintf(w, "  flag %s%s\n", strings.Join(f.Names(), ", "), reportOrigin(f.Source, f.Confidence, f.Line))
+		}
+		for _, sub := range c.Subcommands {
+			subs++
+			if sub.Confidence > 0 && sub.Confidence < lowConfidence {
+				low++
+			}
+			walk(sub, path+" "+sub.Name)
+		}
+	}
+	walk(cmd, cmd.Name)
+
+	var rejected []Diagnostic
+	if diag != nil {
+		diag.mu.Lock()
+		for _, e := range diag.Entries {
+			if !e.Accepted {
+				rejected = append(rejected, e)
+			}
+		}
+		diag.mu.Unlock()
+	}
+	if len(rejected) > 0 {
+		fmt.Fprintf(w, "\n-- Rejected lines --\n")
+		for _, e := range rejected {
+			fmt.Fprintf(w, "  [%s] %s %s: %s\n      %q\n", e.Source, e.Command, e.Kind, e.Reason, e.Line)
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d flags, %d subcommands, %d low confidence (< %.1f), %d rejected lines\n",
+		flags, subs, low, lowConfidence, len(rejected))
+}
+
+// reportOrigin formats "  [--help 0.95] "  -v, --verbose  ..."" for a report line.
+func reportOrigin(src model.Source, confidence float64, line string) string {
+	if src == "" {
+		return ""
+	}
+	s := fmt.Sprintf("  [%s %.2f]", src, confidence)
+	if line != "" {
+		s += fmt.Sprintf(" %q", strings.TrimSpace(line))
+	}
+	return s
+}
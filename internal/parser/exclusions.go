@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+// excludesPattern matches prose that introduces the flags a flag cannot be
+// combined with, e.g. "Cannot be used with --all." or "mutually exclusive with -q".
+var excludesPattern = regexp.MustCompile(`(?i)(?:(?:cannot|can't|can not|may not|must not) be (?:used|combined|specified) (?:together )?with|mutually exclusive with|incompatible with|conflicts with)\s+([^.;]*)`)
+
+// proseFlagPattern matches a flag spelling inside prose.
+var proseFlagPattern = regexp.MustCompile("(?:^|[\\s,'\"(`])(--?[a-zA-Z0-9][a-zA-Z0-9\\-]*)")
+
+// exclusionGroupPattern matches usage/synopsis groups of alternative flags: [-a | -b], (-q|-v).
+var exclusionGroupPattern = regexp.MustCompile(`[\[(]\s*(-[^\[\]()|]*(?:\|\s*-[^\[\]()|]*)+)[\])]`)
+
+// excludedFlags returns the flags a description says cannot be used together
+// with the flag it describes.
+func excludedFlags(desc string) []string {
+	var names []string
+	for _, m := range excludesPattern.FindAllStringSubmatch(desc, -1) {
+		for _, f := range proseFlagPattern.FindAllStringSubmatch(m[1], -1) {
+			names = append(names, f[1])
+		}
+	}
+	return names
+}
+
+// exclusionGroups returns the groups of mutually exclusive flags shown in the
+// usage lines and SYNOPSIS section, e.g. [-a | -b] → ["-a", "-b"].
+func exclusionGroups(lines []string) [][]string {
+	text := strings.Join(collectUsageLines(lines), " ") + " " + strings.Join(collectSynopsis(lines), " ")
+
+	var groups [][]string
+	for _, m := range exclusionGroupPattern.FindAllStringSubmatch(text, -1) {
+		var group []string
+		for _, member := range strings.Split(m[1], "|") {
+			fields := strings.Fields(member)
+			if len(fields) == 0 {
+				continue
+			}
+			// "--output=FILE" / "-o FILE" → the flag name only
+			group = append(group, strings.SplitN(fields[0], "=", 2)[0])
+		}
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// applyExclusionGroups makes exclusions symmetric and expands them to every
+// spelling: if -a excludes --bee, then --bee (and -b) excludes -a (and --ay).
+// Flags in the same group exclude each other. Excluded names that don't
+// belong to any known flag are kept as written.
+func applyExclusionGroups(flags []model.Flag, groups [][]string) {
+	index := map[string]int{}
+	for i, f := range flags {
+		for _, n := range f.Names() {
+			index[n] = i
+		}
+		if f.Negatable && f.Long != "" {
+			index["--no-"+strings.TrimPrefix(f.Long, "--")] = i
+		}
+	}
+
+	linked := make([]map[int]bool, len(flags))
+	link := func(i, j int) {
+		if i == j {
+			return
+		}
+		if linked[i] == nil {
+			linked[i] = map[int]bool{}
+		}
+		if linked[j] == nil {
+			linked[j] = map[int]bool{}
+		}
+		linked[i][j] = true
+		linked[j][i] = true
+	}
+
+	unknown := make([][]string, len(flags))
+	for i, f := range flags {
+		for _, n := range f.Excludes {
+			if j, ok := index[n]; ok {
+				link(i, j)
+			} else {
+				unknown[i] = append(unknown[i], n)
+			}
+		}
+	}
+	for _, g := range groups {
+		for _, a := range g {
+			for _, b := range g {
+				i, iok := index[a]
+				j, jok := index[b]
+				if iok && jok {
+					link(i, j)
+				}
+			}
+		}
+	}
+
+	for i := range flags {
+		var excludes []string
+		for j := range flags {
+			if linked[i][j] {
+				excludes = append(excludes, flags[j].Names()...)
+			}
+		}
+		flags[i].Excludes = append(excludes, unknown[i]...)
+	}
+}
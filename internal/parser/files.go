@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// helpFileName is the name of the help file of each command in a help
+// directory: DIR/help.txt for the program, DIR/<sub>/help.txt for a subcommand.
+const helpFileName = "help.txt"
+
+// fileSource serves help and man text from files (or stdin) instead of
+// running the program or man.
+type fileSource struct {
+	helpPath string // file, directory or "-"
+	manPath  string // roff source, gzipped roff or rendered text, or "-"
+	stdin    io.Reader
+}
+
+// help returns the help text of the subcommand at path (nil for the program).
+// Subcommands only have help when helpPath is a directory.
+func (f *fileSource) help(path []string) (string, error) {
+	if f.helpPath == "" {
+		return "", fmt.Errorf("no help file given")
+	}
+	file := f.helpPath
+	if f.helpPath != "-" {
+		if info, err := os.Stat(f.helpPath); err == nil && info.IsDir() {
+			file = filepath.Join(append(append([]string{f.helpPath}, path...), helpFileName)...)
+		} else if len(path) > 0 {
+			return "", fmt.Errorf("no help file for %q", strings.Join(path, " "))
+		}
+	}
+	text, err := f.read(file)
+	if err != nil {
+		return "", err
+	}
+	text = normalizeOutput(text)
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("%s is empty", file)
+	}
+	return text, nil
+}
+
+// man returns the rendered man page, or "" if no man file was given.
+func (f *fileSource) man() (string, error) {
+	if f.manPath == "" {
+		return "", nil
+	}
+	text, err := f.read(f.manPath)
+	if err != nil {
+		return "", err
+	}
+	if looksLikeRoff(text) {
+		text = renderRoff(text)
+	}
+	return text, nil
+}
+
+// read returns the content of file ("-" for stdin), decompressing gzip.
+func (f *fileSource) read(file string) (string, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(f.stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return "", err
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", file, err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return "", fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return string(data), nil
+}
@@ -1,7 +1,7 @@
 package parser
 
 import (
-	"os/exec"
+	"context"
 	"regexp"
 	"strings"
 
@@ -14,30 +14,83 @@ import (
 var splitLinePattern = regexp.MustCompile(`^(\s{1,12}-[^\t]+?)(?:\s{2,}|\t)(.+)$`)
 
 // longFlagPattern extracts long flags from the flags part.
-// Handles --flag and --[no-]flag (git-style).
-var longFlagPattern = regexp.MustCompile(`--(?:\[no-\])?([a-zA-Z0-9][a-zA-Z0-9\-]*)`)
+// Handles --flag and --[no-]flag (git-style); group 1 is non-empty for the latter.
+var longFlagPattern = regexp.MustCompile(`--(\[no-\])?([a-zA-Z0-9][a-zA-Z0-9\-]*)`)
 
 // shortFlagPattern extracts short flags from the flags part.
-var shortFlagPattern = regexp.MustCompile(`(?:^|[,\s])(-[a-zA-Z0-9])(?:[,\s]|$)`)
+var shortFlagPattern = regexp.MustCompile(`(?:^|[,\s])(-[a-zA-Z0-9])(?:[,\s=\[]|$)`)
 
-// takesArgPattern detects whether a flag takes a value.
-var takesArgPattern = regexp.MustCompile(`(?i)(value|<[^>]+>|\[.*\]|file|path|string|int|num|port|url|host|addr|dir|name|key|secret|token)`)
+// oldFlagPattern extracts single-dash long options like -verbose or -name
+// (Go flag package, X11 and Java tools).
+var oldFlagPattern = regexp.MustCompile(`(?:^|[,\s])(-[a-zA-Z0-9][a-zA-Z0-9_\-]+)(?:[,\s=\[]|$)`)
 
-// subcommandPattern matches lines in COMMANDS/SUBCOMMANDS sections.
-var subcommandPattern = regexp.MustCompile(`^\s{2,4}([a-z][a-zA-Z0-9_\-]+)\s{2,}(.+)$`)
+// takesArgPattern detects whether a flag takes a value. It is applied to the
+// flags part with the flag names removed, so "-name" or "--hostname" alone don't match.
+var takesArgPattern = regexp.MustCompile(`(?i)(value|<[^>]+>|\[.*\]|file|path|string|int|float|duration|num|port|url|host|addr|dir|name|key|secret|token)`)
+
+// optionalValuePattern matches a flag with an optional attached value:
+// --color[=WHEN], -O[level].
+var optionalValuePattern = regexp.MustCompile(`-[a-zA-Z0-9][a-zA-Z0-9_\-]*\[(=?)[^\]\s]*\]`)
+
+// equalsValuePattern matches a flag whose value is written with "=": --output=FILE.
+var equalsValuePattern = regexp.MustCompile(`-[a-zA-Z0-9][a-zA-Z0-9_\-]*=`)
+
+// placeholderWordPattern matches an uppercase value placeholder like N or FILE.
+var placeholderWordPattern = regexp.MustCompile(`\b[A-Z][A-Z0-9_]*\b`)
+
+// goFlagContinuation is the prefix the Go flag package puts before every
+// description line ("  -name string\n    \tdescription").
+const goFlagContinuation = "    \t"
+
+// subcommandPattern matches lines in COMMANDS/SUBCOMMANDS sections, indented
+// with 2-4 spaces or a tab (go help).
+var subcommandPattern = regexp.MustCompile(`^(?: {2,4}|\t)([a-z][a-zA-Z0-9_\-]+)\s{2,}(.+)$`)
 
 // flagOnlyPattern matches a flag line that has no description on the same line.
 var flagOnlyPattern = regexp.MustCompile(`^\s{1,12}(-[a-zA-Z0-9,\s\-\[\]<>=]+?)$`)
 
+// defaultPattern matches default-value annotations in a flag description:
+// (default "info"), (default: 3), (defaults to x), [default: 8080].
+var defaultPattern = regexp.MustCompile(`(?i)\s*[\(\[]defaults?(?:\s+to|:)?\s+([^\)\]]*)[\)\]]`)
+
+// envPattern matches environment variable bindings in a flag description:
+// [env: APP_PORT=] (clap), (env: APP_PORT), [$APP_PORT] (urfave/cli).
+var envPattern = regexp.MustCompile(`(?i)\s*(?:\[env:\s*([a-z_][a-z0-9_]*)[^\]]*\]|\(env:?\s*\$?([a-z_][a-z0-9_]*)\)|\[\$([a-z_][a-z0-9_]*)[^\]]*\])`)
+
+// splitFlagDescription separates default-value and environment annotations
+// from a flag description, returning the cleaned description and the values.
+func splitFlagDescription(desc string) (clean, def, env string) {
+	if m := defaultPattern.FindStringSubmatch(desc); m != nil {
+		def = strings.Trim(strings.TrimSpace(m[1]), `"'`)
+		desc = strings.Replace(desc, m[0], "", 1)
+	}
+	if m := envPattern.FindStringSubmatch(desc); m != nil {
+		for _, g := range m[1:] {
+			if g != "" {
+				env = g
+				break
+			}
+		}
+		desc = strings.Replace(desc, m[0], "", 1)
+	}
+	return strings.TrimSpace(desc), def, env
+}
+
+// flagColumnPattern matches a leading column of a description that belongs to
+// the flag: another spelling ("-n") or a value type ("TEXT", "<path>"), as
+// printed in separate columns by typer/rich ("--name  -n  TEXT  Description").
+var flagColumnPattern = regexp.MustCompile(`^(-{1,2}[a-zA-Z0-9][a-zA-Z0-9_\-]*|[A-Z][A-Z0-9_]*|<[^>]+>)\s{2,}(.+)$`)
+
 // indentOf returns the number of leading spaces/tabs in a line.
 func indentOf(line string) int {
 	return len(line) - len(strings.TrimLeft(line, " \t"))
 }
 
-// extractFlags parses help output lines and returns all found flags.
+// extractFlags parses help output lines and returns all found flags, tagged
+// with src. Candidate lines that don't yield a flag are reported to log.
 // Handles single-line, man-page style (flag then description on next line),
 // and continuation multi-line descriptions.
-func extractFlags(lines []string) []model.Flag {
+func extractFlags(lines []string, src model.Source, log *lineLog) []model.Flag {
 	var flags []model.Flag
 	seen := map[string]bool{}
 
@@ -70,8 +123,16 @@ func extractFlags(lines []string) []model.Flag {
 					!strings.HasPrefix(nextTrimmed, "-") &&
 					nextIndent > curIndent {
 					// Merge: flag + description from next line
-					joined = append(joined, strings.TrimRight(line, " \t")+"    "+nextTrimmed)
+					merged := strings.TrimRight(line, " \t") + "    " + nextTrimmed
 					i++ // skip next line (already consumed)
+					// Go flag package: further description lines share the same prefix
+					if strings.HasPrefix(next, goFlagContinuation) {
+						for i+1 < len(lines) && strings.HasPrefix(lines[i+1], goFlagContinuation) {
+							i++
+							merged += " " + strings.TrimSpace(lines[i])
+						}
+					}
+					joined = append(joined, merged)
 					continue
 				}
 			}
@@ -88,11 +149,23 @@ func extractFlags(lines []string) []model.Flag {
 
 		m := splitLinePattern.FindStringSubmatch(line)
 		if m == nil {
+			if strings.HasPrefix(strings.TrimSpace(line), "-") {
+				log.reject("flag", line, "no description column (2+ spaces or tab) after the flag")
+			}
 			continue
 		}
 
 		flagsPart := m[1]
-		desc := strings.TrimSpace(m[2])
+		rawDesc := strings.TrimSpace(m[2])
+		for {
+			c := flagColumnPattern.FindStringSubmatch(rawDesc)
+			if c == nil {
+				break
+			}
+			flagsPart += " " + c[1]
+			rawDesc = c[2]
+		}
+		desc, def, env := splitFlagDescription(rawDesc)
 
 		if !strings.Contains(flagsPart, "-") {
 			continue
@@ -100,50 +173,126 @@ func extractFlags(lines []string) []model.Flag {
 
 		longs := longFlagPattern.FindAllStringSubmatch(flagsPart, -1)
 		shorts := shortFlagPattern.FindAllStringSubmatch(flagsPart, -1)
+		olds := oldFlagPattern.FindAllStringSubmatch(flagsPart, -1)
 
-		if len(longs) == 0 && len(shorts) == 0 {
+		if len(longs) == 0 && len(shorts) == 0 && len(olds) == 0 {
+			log.reject("flag", line, "no flag names found")
 			continue
 		}
 
-		long := ""
-		if len(longs) > 0 {
-			long = "--" + longs[0][1]
+		// The first spelling of each kind fills Short/Long/Old; any further
+		// spellings ("-f, --force, --yes") become aliases.
+		var long, short, old string
+		var aliases []string
+		for _, l := range longs {
+			if name := "--" + l[2]; long == "" {
+				long = name
+			} else if name != long {
+				aliases = append(aliases, name)
+			}
 		}
-		short := ""
-		if len(shorts) > 0 {
-			short = shorts[0][1]
+		for _, sh := range shorts {
+			if short == "" {
+				short = sh[1]
+			} else if sh[1] != short {
+				aliases = append(aliases, sh[1])
+			}
+		}
+		for _, o := range olds {
+			if old == "" {
+				old = o[1]
+			} else if o[1] != old {
+				aliases = append(aliases, o[1])
+			}
+		}
+
+		// A "--no-x" spelling next to "--x" (typer boolean pairs) is a negation, not an alias.
+		negatable := len(longs) > 0 && longs[0][1] != ""
+		for i, a := range aliases {
+			if long != "" && a == "--no-"+strings.TrimPrefix(long, "--") {
+				aliases = append(aliases[:i], aliases[i+1:]...)
+				negatable = true
+				break
+			}
 		}
 
-		key := long
-		if key == "" {
-			key = short
+		f := model.Flag{Short: short, Long: long, Old: old, Aliases: aliases}
+		dup := ""
+		for _, n := range f.Names() {
+			if seen[n] {
+				dup = n
+			}
 		}
-		if seen[key] {
+		if dup != "" {
+			log.reject("flag", line, "duplicate of "+dup)
 			continue
 		}
-		seen[key] = true
+		for _, n := range f.Names() {
+			seen[n] = true
+		}
 
-		flags = append(flags, model.Flag{
-			Short:       short,
-			Long:        long,
-			Description: desc,
-			TakesArg:    takesArgPattern.MatchString(flagsPart),
-		})
+		f.Description = desc
+		f.TakesArg, f.OptionalArg, f.EqualsForm = valueForm(flagsPart)
+		f.Default = def
+		f.Env = env
+		f.Negatable = negatable
+		f.Repeatable = repeatable(flagsPart, desc)
+		f.Excludes = excludedFlags(desc)
+		f.Source = src
+		f.Line = line
+		f.Confidence = flagConfidence(f)
+		flags = append(flags, f)
+		log.accept("flag", line)
 	}
 
+	applyExclusionGroups(flags, exclusionGroups(lines))
 	return flags
 }
 
+// valueForm reports how a flag takes its value: required (takes), optional and
+// attached (optional), and whether the value is written with "=" (equals).
+func valueForm(flagsPart string) (takes, optional, equals bool) {
+	if m := optionalValuePattern.FindStringSubmatch(flagsPart); m != nil {
+		return false, true, m[1] == "="
+	}
+	return takesArg(flagsPart), false, equalsValuePattern.MatchString(flagsPart)
+}
+
+// takesArg reports whether the flags part of a help line declares a value,
+// e.g. "-o, --output FILE", "--url=<url>" or "-n int" (Go flag package).
+func takesArg(flagsPart string) bool {
+	rest := longFlagPattern.ReplaceAllString(flagsPart, " ")
+	rest = oldFlagPattern.ReplaceAllString(rest, " ")
+	rest = shortFlagPattern.ReplaceAllString(rest, " ")
+	return takesArgPattern.MatchString(rest) || placeholderWordPattern.MatchString(rest)
+}
+
+// repeatableValuePattern matches value placeholders that imply the flag may be
+// repeated: "-v...", "--include PATTERN...", cobra's "stringArray"/"strings".
+var repeatableValuePattern = regexp.MustCompile(`(\.\.\.|(?i:array|slice)\b|\bstrings\b)`)
+
+// repeatableDescPattern matches descriptions saying a flag may be repeated.
+var repeatableDescPattern = regexp.MustCompile(`(?i)((can|may) be (specified|used|given|passed|repeated) (multiple|several) times|(can|may) be (specified|used|given|passed) more than once|(can|may) be repeated|\(repeatable\)|\[multiple\])`)
+
+// repeatable reports whether a flag may be given several times.
+func repeatable(flagsPart, desc string) bool {
+	return repeatableValuePattern.MatchString(flagsPart) || repeatableDescPattern.MatchString(desc)
+}
+
 // subcommandNamePattern matches a valid subcommand name (1+ lowercase word with optional hyphens).
 var subcommandNamePattern = regexp.MustCompile(`^[a-z][a-zA-Z0-9_\-]*$`)
 
 // twoSpacesSplit splits a string on 2+ consecutive spaces (used to separate args from description).
 var twoSpacesSplit = regexp.MustCompile(`\s{2,}`)
 
-// subEntry holds a subcommand name and its description from the help output.
+// subEntry holds a subcommand name, its aliases and its description from the help output,
+// with the line it was listed on and how much we trust it.
 type subEntry struct {
-	name string
-	desc string
+	name       string
+	aliases    []string
+	desc       string
+	line       string
+	confidence float64
 }
 
 // extractSubcommands finds subcommand names and descriptions from help output.
@@ -155,11 +304,13 @@ type subEntry struct {
 // When strict=true, only explicit COMMANDS/SUBCOMMANDS section headers are trusted
 // (safe for man pages). When strict=false, heuristic detection is also used
 // (suitable for --help output which is generally cleaner).
-func extractSubcommands(lines []string, strict bool) []subEntry {
+// Lines inside a commands section that don't yield a subcommand are reported to log.
+func extractSubcommands(lines []string, strict bool, log *lineLog) []subEntry {
 	var subs []subEntry
 	seen := map[string]bool{}
 	inCommandsSection := false
-	sectionIndent := -1 // indent level of subcommand entries in current section
+	foundSection := false // unlabelled lists after a commands section are something else (go help topics)
+	sectionIndent := -1   // indent level of subcommand entries in current section
 
 	for i, line := range lines {
 		low := strings.ToLower(strings.TrimSpace(line))
@@ -167,7 +318,7 @@ func extractSubcommands(lines []string, strict bool) []subEntry {
 		// Section headers must have minimal indent (≤ 4 spaces) to avoid
 		// matching prose lines like "            command. If --help..."
 		if indentOf(line) <= 4 && isCommandsHeader(low) {
-			inCommandsSection = true
+			inCommandsSection, foundSection = true, true
 			sectionIndent = -1
 			continue
 		}
@@ -177,7 +328,7 @@ func extractSubcommands(lines []string, strict bool) []subEntry {
 			sectionIndent = -1
 		}
 
-		if !inCommandsSection && (strict || !looksLikeSubcommandLine(line)) {
+		if !inCommandsSection && (strict || foundSection || !looksLikeSubcommandLine(line)) {
 			continue
 		}
 
@@ -199,12 +350,24 @@ func extractSubcommands(lines []string, strict bool) []subEntry {
 
 			// Split on 2+ spaces to separate "name [args]" from "description"
 			parts := twoSpacesSplit.Split(trimmed, 2)
-			firstWord := strings.SplitN(parts[0], " ", 2)[0]
+			names := splitCommandNames(parts[0])
+			if len(names) == 0 {
+				log.reject("subcommand", line, "not a command name")
+				continue
+			}
+			firstWord := names[0]
 
-			if !subcommandNamePattern.MatchString(firstWord) || isReservedWord(firstWord) || seen[firstWord] {
+			if isReservedWord(firstWord) {
+				log.reject("subcommand", line, "reserved word "+firstWord)
 				continue
 			}
-			seen[firstWord] = true
+			if seen[firstWord] {
+				log.reject("subcommand", line, "duplicate of "+firstWord)
+				continue
+			}
+			for _, n := range names {
+				seen[n] = true
+			}
 
 			desc := ""
 			if len(parts) > 1 {
@@ -223,7 +386,8 @@ func extractSubcommands(lines []string, strict bool) []subEntry {
 				}
 			}
 
-			subs = append(subs, subEntry{name: firstWord, desc: desc})
+			subs = append(subs, subEntry{name: firstWord, aliases: names[1:], desc: desc, line: line, confidence: 0.9})
+			log.accept("subcommand", line)
 		} else {
 			// Outside COMMANDS section: use strict pattern (avoids false positives)
 			if m := subcommandPattern.FindStringSubmatch(line); m != nil {
@@ -232,7 +396,9 @@ func extractSubcommands(lines []string, strict bool) []subEntry {
 					continue
 				}
 				seen[name] = true
-				subs = append(subs, subEntry{name: name, desc: strings.TrimSpace(m[2])})
+				// Unlabelled lists are a heuristic: trust them less.
+				subs = append(subs, subEntry{name: name, desc: strings.TrimSpace(m[2]), line: line, confidence: 0.6})
+				log.accept("subcommand", line)
 			}
 		}
 	}
@@ -240,6 +406,54 @@ func extractSubcommands(lines []string, strict bool) []subEntry {
 	return subs
 }
 
+// splitCommandNames splits the name column of a commands list into the
+// command name and its aliases: "rm, remove [args]", "list | ls", "ls,list".
+// It stops at the first word that isn't a name (argument placeholders).
+func splitCommandNames(s string) []string {
+	var names []string
+	fields := strings.Fields(s)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if field == "|" {
+			continue
+		}
+		more := strings.HasSuffix(field, ",") || (i+1 < len(fields) && fields[i+1] == "|")
+		for _, part := range strings.FieldsFunc(field, func(r rune) bool { return r == ',' || r == '|' }) {
+			if !subcommandNamePattern.MatchString(part) {
+				return names
+			}
+			names = append(names, part)
+		}
+		if !more {
+			break
+		}
+	}
+	return names
+}
+
+// extractAliases returns the aliases listed in a cobra-style "Aliases:" section
+// ("Aliases:\n  list, ls") or inline ("Aliases: ls, list"), excluding name itself.
+func extractAliases(lines []string, name string) []string {
+	var aliases []string
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(strings.ToLower(trimmed), "aliases:") {
+			continue
+		}
+		rest := strings.TrimSpace(trimmed[len("aliases:"):])
+		if rest == "" && i+1 < len(lines) {
+			rest = strings.TrimSpace(lines[i+1])
+		}
+		for _, a := range splitCommandNames(rest) {
+			if a != name {
+				aliases = append(aliases, a)
+			}
+		}
+		break
+	}
+	return aliases
+}
+
 // looksLikeSubcommandLine returns true for lines with 3-4 spaces indent,
 // a short lowercase word, then 2+ spaces and a description (git-style).
 func looksLikeSubcommandLine(line string) bool {
@@ -253,16 +467,19 @@ func isOptionsHeader(s string) bool {
 		strings.HasPrefix(s, "available option")
 }
 
+// commandsHeaderPattern matches headers that introduce a list of commands
+// in a few words: "Available commands:", "The commands are:" (go help),
+// "Management Commands:".
+var commandsHeaderPattern = regexp.MustCompile(`^(?:[a-z]+ ){0,3}(?:sub)?commands(?: are)?:$`)
+
 func isCommandsHeader(s string) bool {
 	// s is already trimmed and lowercased.
 	// Accept only known header patterns. Using "commands" (plural) avoids
 	// matching prose lines like "command. If --help..." or "command(<action>)".
 	return s == "commands" ||
-		s == "commands:" ||
 		s == "command:" ||
 		s == "subcommands" ||
-		s == "subcommands:" ||
-		s == "available commands:" ||
+		commandsHeaderPattern.MatchString(s) ||
 		strings.HasPrefix(s, "commands ")
 }
 
@@ -273,20 +490,26 @@ func isReservedWord(s string) bool {
 	return reserved[s]
 }
 
-// parseManPage runs man and returns a Command with flags, subcommands, and positional args.
-func parseManPage(program string) (*model.Command, error) {
-	out, err := exec.Command("sh", "-c", "man "+program+" 2>/dev/null | col -bx").Output()
+// parseManPage reads the man page of program and returns a Command with
+// flags, subcommands, and positional args.
+func (s *helpSession) parseManPage(ctx context.Context, program string) (*model.Command, error) {
+	out, err := s.manText(ctx, program)
 	if err != nil || len(out) == 0 {
 		return nil, err
 	}
 
-	lines := strings.Split(string(out), "\n")
-	cmd := &model.Command{Name: program}
-	cmd.Flags = extractFlags(lines)
-	for _, e := range extractSubcommands(lines, true) {
+	lines := strings.Split(normalizeOutput(out), "\n")
+	log := s.diag.log(program, model.SourceMan)
+	cmd := &model.Command{Name: program, Source: model.SourceMan, Confidence: 1}
+	cmd.Flags = extractFlags(lines, model.SourceMan, log)
+	for _, e := range extractSubcommands(lines, true, log) {
 		cmd.Subcommands = append(cmd.Subcommands, &model.Command{
 			Name:        e.name,
+			Aliases:     e.aliases,
 			Description: e.desc,
+			Source:      model.SourceMan,
+			Line:        e.line,
+			Confidence:  e.confidence,
 		})
 	}
 	cmd.Args = extractPositionalArgs(lines, program)
@@ -297,12 +520,29 @@ func parseManPage(program string) (*model.Command, error) {
 // Matches both required <arg-name> and optional [<arg-name>] or [arg-name].
 var synopsisArgPattern = regexp.MustCompile(`(\[?)<([a-zA-Z][a-zA-Z0-9_\- ]+)>(\]?)`)
 
-// extractPositionalArgs parses the SYNOPSIS section to find positional arguments,
-// then looks up their descriptions in the DESCRIPTION section.
-func extractPositionalArgs(lines []string, program string) []model.Arg {
-	// Step 1: find SYNOPSIS and collect the positional arg names in order.
+// manText returns the rendered man page of program, from the man file if one
+// was given, otherwise by running man. If the page renders empty in the C
+// locale (e.g. only a translated page exists), it is retried in the user's locale.
+func (s *helpSession) manText(ctx context.Context, program string) (string, error) {
+	if s.files != nil {
+		return s.files.man()
+	}
+	run := func(env []string) ([]byte, error) {
+		// Stderr is discarded so "No manual entry" doesn't count as output.
+		// The program is passed as $1, never spliced into the script.
+		return s.runProbe(ctx, env, "sh", "-c", `man -- "$1" 2>/dev/null | col -bx 2>/dev/null`, "sh", program)
+	}
+	out, err := run(helpEnv(s.keepLocale))
+	if err == nil && len(strings.TrimSpace(string(out))) == 0 && !s.keepLocale {
+		out, err = run(helpEnv(true))
+	}
+	return string(out), err
+}
+
+// collectSynopsis returns the lines of a man page's SYNOPSIS section.
+func collectSynopsis(lines []string) []string {
 	inSynopsis := false
-	synopsisLines := []string{}
+	var synopsisLines []string
 
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
@@ -319,7 +559,14 @@ func extractPositionalArgs(lines []string, program string) []model.Arg {
 			synopsisLines = append(synopsisLines, line)
 		}
 	}
+	return synopsisLines
+}
 
+// extractPositionalArgs parses the SYNOPSIS section to find positional arguments,
+// then looks up their descriptions in the DESCRIPTION section.
+func extractPositionalArgs(lines []string, program string) []model.Arg {
+	// Step 1: find SYNOPSIS and collect the positional arg names in order.
+	synopsisLines := collectSynopsis(lines)
 	if len(synopsisLines) == 0 {
 		return nil
 	}
@@ -448,4 +695,3 @@ func extractArgDescriptions(lines []string, names map[string]bool) map[string]st
 	}
 	return result
 }
-
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// readFixture returns the lines of a file under testdata, normalized like
+// probed output.
+func readFixture(t *testing.T, name string) []string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(normalizeOutput(string(data)), "\n")
+}
+
+func subcommandNames(subs []subEntry) []string {
+	var names []string
+	for _, s := range subs {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+func TestIsCommandsHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"commands:", true},
+		{"commands", true},
+		{"command:", true},
+		{"subcommands:", true},
+		{"available commands:", true},
+		{"the commands are:", true},
+		{"management commands:", true},
+		{"commands (in order):", true},
+		{"command. if --help is given", false},
+		{"run one of the following commands to get started with your project:", false},
+		{"additional help topics:", false},
+		{"options:", false},
+	}
+	for _, tt := range tests {
+		if got := isCommandsHeader(tt.header); got != tt.want {
+			t.Errorf("isCommandsHeader(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestExtractSubcommands(t *testing.T) {
+	tests := []struct {
+		fixture string
+		strict  bool
+		want    []string
+		notWant []string
+	}{
+		{
+			// Tab-indented list after "The commands are:", followed by help
+			// topics that are not commands
+			fixture: "go/help.txt",
+			want:    []string{"bug", "build", "clean", "doc", "env", "mod", "test", "vet", "work"},
+			notWant: []string{"buildmode", "gopath", "modules", "vcs"},
+		},
+		{
+			fixture: "go/help.txt",
+			strict:  true,
+			want:    []string{"build", "mod", "work"},
+			notWant: []string{"buildmode", "gopath"},
+		},
+	}
+	for _, tt := range tests {
+		got := subcommandNames(extractSubcommands(readFixture(t, tt.fixture), tt.strict, nil))
+		for _, name := range tt.want {
+			if !slices.Contains(got, name) {
+				t.Errorf("%s (strict=%v): missing subcommand %q in %v", tt.fixture, tt.strict, name, got)
+			}
+		}
+		for _, name := range tt.notWant {
+			if slices.Contains(got, name) {
+				t.Errorf("%s (strict=%v): unexpected subcommand %q", tt.fixture, tt.strict, name)
+			}
+		}
+	}
+}
+
+// TestManTextQuoting checks that the program name reaches man as a single
+// argument instead of being interpreted by the shell.
+func TestManTextQuoting(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("needs sh")
+	}
+	bin := t.TempDir()
+	// A man that prints its arguments; col is left to fail quietly, so
+	// stand in a cat for it.
+	for name, script := range map[string]string{
+		"man": "#!/bin/sh\nfor a in \"$@\"; do echo \"[$a]\"; done\n",
+		"col": "#!/bin/sh\ncat\n",
+	} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	marker := filepath.Join(t.TempDir(), "pwned")
+	program := "foo; touch " + marker
+	s := newHelpSession(Options{})
+	got, err := s.manText(context.Background(), program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[--]\n[" + program + "]\n"; got != want {
+		t.Errorf("man got arguments %q, want %q", got, want)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("program name was run by the shell")
+	}
+}
@@ -0,0 +1,253 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/TerenceU/the-autocompletor/internal/installer"
+	"github.com/TerenceU/the-autocompletor/internal/model"
+	"github.com/TerenceU/the-autocompletor/internal/shell"
+)
+
+// nativeConfidence is the confidence given to entries read from installed
+// completion scripts: they were written for the program, not scraped.
+const nativeConfidence = 0.9
+
+// findCompletionScript returns the first completion script installed for
+// program in the directories sh loads them from that was not generated by
+// theautocompletor, with its content.
+func findCompletionScript(sh shell.Shell, program string) (string, string) {
+	for _, path := range installer.ExistingAll(sh, program) {
+		if installer.Generated(path) {
+			continue
+		}
+		if data, err := os.ReadFile(path); err == nil {
+			return path, string(data)
+		}
+	}
+	return "", ""
+}
+
+// parseNative reads the fish and zsh completion scripts installed for
+// program and merges what they declare into one tree, or returns nil if
+// there are none. Bash scripts are shell functions that can't be read
+// without running bash, so they aren't harvested.
+func (s *helpSession) parseNative(program string) *model.Command {
+	name := filepath.Base(program)
+	var cmd *model.Command
+
+	if path, script := findCompletionScript(shell.Fish, name); path != "" {
+		s.notify(fmt.Sprintf("reading installed completions %s", path))
+		cmd = parseFishScript(name, script, s.diag.log(name, model.SourceNative))
+	}
+	if path, script := findCompletionScript(shell.Zsh, name); path != "" {
+		s.notify(fmt.Sprintf("reading installed completions %s", path))
+		zshCmd := parseZshScript(name, script, s.diag.log(name, model.SourceNative))
+		if cmd == nil {
+			cmd = zshCmd
+		} else {
+			mergeNative(cmd, zshCmd)
+		}
+	}
+
+	if cmd == nil || (len(cmd.Flags) == 0 && len(cmd.Subcommands) == 0) {
+		return nil
+	}
+	cmd.Subcommands = slices.DeleteFunc(cmd.Subcommands, func(c *model.Command) bool {
+		return s.ignored(nil, c.Name)
+	})
+	return cmd
+}
+
+// mergeNative merges the tree read from a completion script into dst. Flags
+// sharing a spelling are combined: the script decides whether a value is
+// taken and which values are offered, while dst keeps its (usually longer)
+// description. Unknown flags and subcommands are added.
+func mergeNative(dst, src *model.Command) {
+	if dst.Description == "" {
+		dst.Description = src.Description
+	}
+	for _, nf := range src.Flags {
+		i := slices.IndexFunc(dst.Flags, func(f model.Flag) bool {
+			for _, n := range nf.Names() {
+				if slices.Contains(f.Names(), n) {
+					return true
+				}
+			}
+			return false
+		})
+		if i < 0 {
+			dst.Flags = append(dst.Flags, nf)
+			continue
+		}
+		f := &dst.Flags[i]
+		for _, n := range nf.Names() {
+			if !slices.Contains(f.Names(), n) {
+				addFlagName(f, n)
+			}
+		}
+		if f.Description == "" {
+			f.Description = nf.Description
+		}
+		if nf.TakesArg || nf.OptionalArg {
+			f.TakesArg, f.OptionalArg = nf.TakesArg, nf.OptionalArg
+			f.EqualsForm = f.EqualsForm || nf.EqualsForm
+		}
+		if len(nf.Values) > 0 {
+			f.Values = nf.Values
+		}
+		f.Repeatable = f.Repeatable || nf.Repeatable
+		f.Excludes = mergeAliases(f.Excludes, nf.Excludes)
+	}
+
+	for _, ns := range src.Subcommands {
+		i := slices.IndexFunc(dst.Subcommands, func(c *model.Command) bool {
+			return slices.Contains(c.Names(), ns.Name)
+		})
+		if i < 0 {
+			dst.Subcommands = append(dst.Subcommands, ns)
+			continue
+		}
+		d := dst.Subcommands[i]
+		d.Aliases = mergeAliases(d.Aliases, slices.DeleteFunc(ns.Aliases, func(a string) bool { return a == d.Name }))
+		mergeNative(d, ns)
+	}
+}
+
+// addFlagName adds a spelling to f in the first free slot: Short, Long, Old, Aliases.
+func addFlagName(f *model.Flag, name string) {
+	switch {
+	case strings.HasPrefix(name, "--"):
+		if f.Long == "" {
+			f.Long = name
+			return
+		}
+	case len(name) == 2:
+		if f.Short == "" {
+			f.Short = name
+			return
+		}
+	default:
+		if f.Old == "" {
+			f.Old = name
+			return
+		}
+	}
+	f.Aliases = append(f.Aliases, name)
+}
+
+// nativeTree accumulates the flags and subcommands read from a completion
+// script, combining repeated declarations of the same flag.
+type nativeTree struct {
+	root *model.Command
+}
+
+// command returns the command a declaration applies to: the root for an
+// empty name, otherwise the (possibly new) subcommand called name.
+func (t *nativeTree) command(name string) *model.Command {
+	if name == "" {
+		return t.root
+	}
+	for _, sub := range t.root.Subcommands {
+		if slices.Contains(sub.Names(), name) {
+			return sub
+		}
+	}
+	sub := &model.Command{Name: name, Source: model.SourceNative, Confidence: nativeConfidence}
+	t.root.Subcommands = append(t.root.Subcommands, sub)
+	return sub
+}
+
+// addFlag adds f to the command called name, merging it with a flag that
+// shares one of its spellings.
+func (t *nativeTree) addFlag(name string, f model.Flag) {
+	mergeNative(t.command(name), &model.Command{Flags: []model.Flag{f}})
+}
+
+// scriptWords splits one line of a shell script into words, honouring
+// single, double and $'...' quotes and backslash escapes. A "#" starting a
+// word begins a comment. If braces is set, unquoted {a,b} groups are expanded
+// (zsh), so one word may yield several; quoted reports whether any part of
+// the word was quoted.
+func scriptWords(line string, braces bool) (words [][]string, quoted []bool) {
+	var cur []string // expansions of the current word
+	inWord, wasQuoted := false, false
+	appendStr := func(s string) {
+		if cur == nil {
+			cur = []string{""}
+		}
+		for i := range cur {
+			cur[i] += s
+		}
+	}
+	flush := func() {
+		if inWord {
+			words = append(words, cur)
+			quoted = append(quoted, wasQuoted)
+		}
+		cur, inWord, wasQuoted = nil, false, false
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == ';':
+			flush()
+		case c == '#' && !inWord:
+			flush()
+			return
+		case c == '\\' && i+1 < len(line):
+			inWord = true
+			i++
+			appendStr(string(line[i]))
+		case c == '\'' || c == '"' || (c == '$' && i+1 < len(line) && line[i+1] == '\''):
+			inWord, wasQuoted = true, true
+			if c == '$' {
+				i++
+				c = '\''
+			}
+			var b strings.Builder
+			for i++; i < len(line) && line[i] != c; i++ {
+				if line[i] == '\\' && i+1 < len(line) && (c == '"' || line[i+1] == '\'' || line[i+1] == '\\') {
+					i++
+				}
+				b.WriteByte(line[i])
+			}
+			appendStr(b.String())
+			if cur == nil {
+				cur = []string{""}
+			}
+		case c == '{' && braces:
+			end := strings.IndexByte(line[i:], '}')
+			alts := ""
+			if end > 0 {
+				alts = line[i+1 : i+end]
+			}
+			if end < 0 || !strings.Contains(alts, ",") || strings.ContainsAny(alts, " '\"") {
+				inWord = true
+				appendStr(string(c))
+				continue
+			}
+			inWord = true
+			if cur == nil {
+				cur = []string{""}
+			}
+			var next []string
+			for _, prefix := range cur {
+				for _, alt := range strings.Split(alts, ",") {
+					next = append(next, prefix+alt)
+				}
+			}
+			cur = next
+			i += end
+		default:
+			inWord = true
+			appendStr(string(c))
+		}
+	}
+	flush()
+	return words, quoted
+}
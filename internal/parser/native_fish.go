@@ -0,0 +1,205 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+// fishSubcommandCondition matches fish conditions that restrict a completion
+// to subcommands: "__fish_seen_subcommand_from add rm", "__fish_git_using_command add".
+var fishSubcommandCondition = regexp.MustCompile(`(not\s+)?__fish_(?:seen_subcommand_from|\w*using_(?:sub)?command)\s+([^;&|)]+)`)
+
+// fishRootCondition matches fish conditions that complete the first word
+// after the program, i.e. its subcommands.
+var fishRootCondition = regexp.MustCompile(`__fish_use_subcommand|__fish_\w*needs_command|not\s+__fish_seen_subcommand_from`)
+
+// fishCompletion is one parsed "complete" line.
+type fishCompletion struct {
+	commands  []string
+	short     []string
+	long      []string
+	old       []string
+	desc      string
+	args      string
+	condition string
+	takesArg  bool
+}
+
+// fishCompleteOptions maps the value-taking options of fish's complete builtin
+// to their short letter; the remaining letters are boolean switches.
+var fishCompleteOptions = map[string]byte{
+	"command": 'c', "path": 'p', "short-option": 's', "long-option": 'l',
+	"old-option": 'o', "description": 'd', "arguments": 'a', "condition": 'n', "wraps": 'w',
+}
+
+// parseFishCompleteLine parses the words of one "complete" line.
+func parseFishCompleteLine(words []string) fishCompletion {
+	var fc fishCompletion
+	set := func(opt byte, val string) {
+		switch opt {
+		case 'c':
+			fc.commands = append(fc.commands, val)
+		case 's':
+			fc.short = append(fc.short, val)
+		case 'l':
+			fc.long = append(fc.long, val)
+		case 'o':
+			fc.old = append(fc.old, val)
+		case 'd':
+			fc.desc = val
+		case 'a':
+			fc.args = strings.TrimSpace(fc.args + " " + val)
+		case 'n':
+			fc.condition = val
+		case 'r', 'x':
+			fc.takesArg = true
+		}
+	}
+
+	for i := 1; i < len(words); i++ {
+		w := words[i]
+		if long, ok := strings.CutPrefix(w, "--"); ok {
+			name, val, hasVal := strings.Cut(long, "=")
+			switch name {
+			case "require-parameter":
+				set('r', "")
+				continue
+			case "exclusive":
+				set('x', "")
+				continue
+			}
+			opt, ok := fishCompleteOptions[name]
+			if !ok {
+				continue
+			}
+			if !hasVal && i+1 < len(words) {
+				i++
+				val = words[i]
+			}
+			set(opt, val)
+			continue
+		}
+		if !strings.HasPrefix(w, "-") {
+			continue
+		}
+		// Grouped short options: -xa 'a b', -fc prog
+		for j := 1; j < len(w); j++ {
+			opt := w[j]
+			if !strings.ContainsRune("cpsloadnw", rune(opt)) {
+				set(opt, "")
+				continue
+			}
+			val := w[j+1:]
+			if val == "" && i+1 < len(words) {
+				i++
+				val = words[i]
+			}
+			set(opt, val)
+			break
+		}
+	}
+	return fc
+}
+
+// fishWords returns the completion candidates in a -a argument, or nil if it
+// is computed at runtime (command substitution or variables).
+func fishWords(args string) []string {
+	if args == "" || strings.ContainsAny(args, "($") {
+		return nil
+	}
+	var words []string
+	for _, w := range strings.Fields(args) {
+		// "add\tAdd files" → "add"
+		w, _, _ = strings.Cut(w, "\t")
+		w, _, _ = strings.Cut(w, `\t`)
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// parseFishScript extracts flags and subcommands of program from a fish
+// completion script, without running fish.
+func parseFishScript(program, script string, log *lineLog) *model.Command {
+	tree := &nativeTree{root: &model.Command{Name: program, Source: model.SourceNative, Confidence: nativeConfidence}}
+
+	for _, line := range strings.Split(script, "\n") {
+		words, _ := scriptWords(line, false)
+		if len(words) == 0 || words[0][0] != "complete" {
+			continue
+		}
+		flat := make([]string, len(words))
+		for i, w := range words {
+			flat[i] = w[0]
+		}
+		fc := parseFishCompleteLine(flat)
+		if !containsCommand(fc.commands, program) {
+			continue
+		}
+
+		// Subcommands the completion is restricted to; none means the root.
+		subs := []string{""}
+		for _, m := range fishSubcommandCondition.FindAllStringSubmatch(fc.condition, -1) {
+			if m[1] == "" {
+				subs = strings.Fields(m[2])
+				break
+			}
+		}
+
+		if len(fc.short)+len(fc.long)+len(fc.old) == 0 {
+			// "complete -c prog -n __fish_use_subcommand -a add -d 'Add files'"
+			if subs[0] != "" || !fishRootCondition.MatchString(fc.condition) {
+				continue
+			}
+			names := fishWords(fc.args)
+			if len(names) == 0 {
+				log.reject("subcommand", line, "candidates are computed at runtime")
+				continue
+			}
+			for _, n := range names {
+				sub := tree.command(n)
+				sub.Line = line
+				if sub.Description == "" {
+					sub.Description = fc.desc
+				}
+			}
+			log.accept("subcommand", line)
+			continue
+		}
+
+		var f model.Flag
+		for _, s := range fc.short {
+			addFlagName(&f, "-"+s)
+		}
+		for _, l := range fc.long {
+			addFlagName(&f, "--"+l)
+		}
+		for _, o := range fc.old {
+			addFlagName(&f, "-"+o)
+		}
+		f.Description = fc.desc
+		f.TakesArg = fc.takesArg
+		if f.TakesArg {
+			f.Values = fishWords(fc.args)
+		}
+		f.Source, f.Line, f.Confidence = model.SourceNative, line, nativeConfidence
+		for _, sub := range subs {
+			tree.addFlag(sub, f)
+		}
+		log.accept("flag", line)
+	}
+	return tree.root
+}
+
+// containsCommand reports whether a -c list names program (by base name).
+func containsCommand(commands []string, program string) bool {
+	for _, c := range commands {
+		if c == program || strings.HasSuffix(c, "/"+program) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package parser
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+// zshSpecPattern matches an _arguments option spec (after brace expansion):
+// '(-q --quiet)*--verbose=[Be verbose]:level:(1 2 3)'.
+// Groups: exclusions, "*", name, value suffix (=, =-, +, -), description, action.
+var zshSpecPattern = regexp.MustCompile(`^(?:\(([^)]*)\))?(\*)?(--?[a-zA-Z0-9?][a-zA-Z0-9_.]*(?:-[a-zA-Z0-9_.]+)*)(=-?|\+|-)?(?:\[((?:[^\]\\]|\\.)*)\])?(:.*)?$`)
+
+// zshArrayStart matches the start of an array assignment listing subcommands:
+// "local -a commands; commands=(", "subcmds=(".
+var zshArrayStart = regexp.MustCompile(`(\w*(?:command|cmds)\w*)=\(`)
+
+// zshCommandEntry matches a "name:description" entry of a subcommand array.
+var zshCommandEntry = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9_.-]*):(.*)$`)
+
+// zshCaseArm matches an unquoted case arm: "add)", "(rm|remove)".
+var zshCaseArm = regexp.MustCompile(`^\s*\(?\s*([a-zA-Z][\w.-]*(?:\s*\|\s*[a-zA-Z][\w.-]*)*)\s*\)`)
+
+// zshFunctionStart matches the definition of a per-subcommand function of
+// program: _prog_add(), _prog-add ().
+func zshFunctionStart(program string) *regexp.Regexp {
+	return regexp.MustCompile(`^\s*(?:function\s+)?_` + regexp.QuoteMeta(program) + `[_-]([a-zA-Z][\w.-]*)\s*\(\)`)
+}
+
+// zshValuesPattern matches a fixed list action: (a b c) or ((a\:desc b\:desc)).
+var zshValuesPattern = regexp.MustCompile(`^\(\(?(.*?)\)?\)$`)
+
+// parseZshScript extracts flags and subcommands of program from a zsh
+// completion function, statically: subcommands come from "name:desc" arrays,
+// flags from _arguments specs, attributed to a subcommand when they appear in
+// its case arm or its _prog_sub function.
+func parseZshScript(program, script string, log *lineLog) *model.Command {
+	tree := &nativeTree{root: &model.Command{Name: program, Source: model.SourceNative, Confidence: nativeConfidence}}
+	lines := strings.Split(script, "\n")
+
+	// First pass: subcommand names.
+	known := map[string]bool{}
+	inArray := false
+	for _, line := range lines {
+		rest := line
+		if !inArray {
+			loc := zshArrayStart.FindStringIndex(line)
+			if loc == nil {
+				continue
+			}
+			inArray, rest = true, line[loc[1]:]
+		}
+		words, quoted := scriptWords(rest, false)
+		for i, w := range words {
+			if w[0] == ")" || strings.HasPrefix(w[0], ")") {
+				inArray = false
+				break
+			}
+			m := zshCommandEntry.FindStringSubmatch(w[0])
+			if !quoted[i] || m == nil {
+				continue
+			}
+			sub := tree.command(strings.ReplaceAll(m[1], `\:`, ":"))
+			if sub.Description == "" {
+				sub.Description = strings.ReplaceAll(m[2], `\:`, ":")
+			}
+			sub.Line = line
+			known[m[1]] = true
+			log.accept("subcommand", line)
+		}
+		if strings.HasSuffix(strings.TrimSpace(rest), ")") {
+			inArray = false
+		}
+	}
+
+	// Second pass: option specs, attributed to the enclosing subcommand.
+	functionStart := zshFunctionStart(program)
+	var current []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if m := functionStart.FindStringSubmatch(line); m != nil {
+			current = nil
+			if known[m[1]] {
+				current = []string{m[1]}
+			}
+		}
+		if m := zshCaseArm.FindStringSubmatch(line); m != nil && !strings.HasPrefix(trimmed, "'") {
+			var names []string
+			for _, n := range strings.Split(m[1], "|") {
+				if n = strings.TrimSpace(n); known[n] {
+					names = append(names, n)
+				}
+			}
+			if len(names) > 0 {
+				current = names
+			}
+		}
+
+		words, quoted := scriptWords(line, true)
+		for i, expansions := range words {
+			if !quoted[i] && len(expansions) == 1 {
+				continue
+			}
+			f, ok := parseZshSpec(expansions)
+			if !ok {
+				continue
+			}
+			f.Source, f.Line, f.Confidence = model.SourceNative, line, nativeConfidence
+			if len(current) == 0 {
+				tree.addFlag("", f)
+			}
+			for _, sub := range current {
+				tree.addFlag(sub, f)
+			}
+			log.accept("flag", line)
+		}
+
+		if trimmed == "}" || strings.HasSuffix(trimmed, ";;") {
+			current = nil
+		}
+	}
+	return tree.root
+}
+
+// parseZshSpec parses the expansions of one _arguments spec word into a
+// flag; {-v,--verbose} expands to one spec per spelling.
+func parseZshSpec(expansions []string) (model.Flag, bool) {
+	var f model.Flag
+	var excludes []string
+	for _, spec := range expansions {
+		m := zshSpecPattern.FindStringSubmatch(spec)
+		if m == nil || (m[1] == "" && m[5] == "" && m[6] == "" && len(expansions) == 1) {
+			// A bare '-r' is more likely an argument to some other command.
+			return model.Flag{}, false
+		}
+		addFlagName(&f, m[3])
+		for _, e := range strings.Fields(m[1]) {
+			if strings.HasPrefix(e, "-") && e != "-" {
+				excludes = append(excludes, e)
+			}
+		}
+		f.Repeatable = f.Repeatable || m[2] == "*"
+		if m[5] != "" {
+			f.Description = zshUnescape(m[5])
+		}
+
+		action := m[6]
+		switch {
+		case strings.HasPrefix(action, "::"):
+			f.OptionalArg = true
+		case action != "":
+			f.TakesArg = true
+		}
+		if strings.HasPrefix(m[4], "=") && strings.HasPrefix(m[3], "--") {
+			f.EqualsForm = true
+		}
+		if action != "" {
+			// ":message:action" → action
+			parts := strings.SplitN(strings.TrimLeft(action, ":"), ":", 2)
+			if len(parts) == 2 {
+				f.Values = zshValues(parts[1])
+			}
+		}
+	}
+
+	names := f.Names()
+	for _, e := range excludes {
+		if !slices.Contains(names, e) && !slices.Contains(f.Excludes, e) {
+			f.Excludes = append(f.Excludes, e)
+		}
+	}
+	return f, true
+}
+
+// zshValues returns the fixed values of a (a b c) or ((a\:desc b\:desc)) action.
+func zshValues(action string) []string {
+	m := zshValuesPattern.FindStringSubmatch(strings.TrimSpace(action))
+	if m == nil {
+		return nil
+	}
+	var values []string
+	for _, v := range strings.Fields(m[1]) {
+		v, _, _ = strings.Cut(v, `\:`)
+		v, _, _ = strings.Cut(v, ":")
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// zshUnescape removes the backslashes zsh specs use before brackets and colons.
+func zshUnescape(s string) string {
+	return strings.NewReplacer(`\]`, "]", `\[`, "[", `\:`, ":").Replace(s)
+}
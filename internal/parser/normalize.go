@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ansiPattern matches terminal escape sequences: CSI (colours, cursor
+// movement), OSC (hyperlinks, window titles) and two-byte ESC sequences.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// panelTopPattern matches the top border of a rich/typer panel and captures
+// its title: "╭─ Options ─────╮" → "Options".
+var panelTopPattern = regexp.MustCompile(`^\s*[╭┌┏╔+][─━═\-]+\s*(.*?)\s*[─━═\-]*[╮┐┓╗+]\s*$`)
+
+// panelBottomPattern matches the bottom border of a panel: "╰──────╯".
+var panelBottomPattern = regexp.MustCompile(`^\s*[╰└┗╚+][─━═\-]+[╯┘┛╝+]\s*$`)
+
+// panelSides are the vertical border characters framing panel content lines.
+const panelSides = "│┃║"
+
+// normalizeOutput turns decorated help output into plain text that the
+// extractors understand: escape sequences and backspace overstrike are
+// removed, and rich/typer panels are unwrapped into "Title:" sections with
+// indented entries.
+func normalizeOutput(s string) string {
+	s = ansiPattern.ReplaceAllString(s, "")
+	s = stripOverstrike(s)
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = unwrapPanelLine(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stripOverstrike removes backspace overstrike as produced by nroff and some
+// help printers: "N\bNA\bAM\bME" (bold) and "_\bf_\bi" (underline).
+func stripOverstrike(s string) string {
+	if !strings.Contains(s, "\b") {
+		return s
+	}
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		if r == '\b' {
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// unwrapPanelLine converts one line of a box-drawn panel:
+//
+//	╭─ Options ──────────╮   →  Options:
+//	│ --name  TEXT  Name │   →    --name  TEXT  Name
+//	╰────────────────────╯   →  (empty line)
+func unwrapPanelLine(line string) string {
+	if m := panelTopPattern.FindStringSubmatch(line); m != nil {
+		if m[1] == "" {
+			return ""
+		}
+		return strings.TrimSuffix(m[1], ":") + ":"
+	}
+	if panelBottomPattern.MatchString(line) {
+		return ""
+	}
+
+	trimmed := strings.TrimLeft(line, " ")
+	first, size := utf8.DecodeRuneInString(trimmed)
+	if size == 0 || !strings.ContainsRune(panelSides, first) {
+		return line
+	}
+	content := strings.TrimRight(trimmed[size:], " ")
+	for _, side := range panelSides {
+		content = strings.TrimSuffix(content, string(side))
+	}
+	// rich marks required options with a leading "*"
+	if rest := strings.TrimLeft(content, " "); strings.HasPrefix(rest, "* ") {
+		content = strings.Replace(content, "*", " ", 1)
+	}
+	// Keep the panel's own indentation and add two spaces so entries read
+	// as indented lines of a section.
+	return "  " + strings.TrimRight(content, " ")
+}
@@ -3,48 +3,153 @@ package parser
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/TerenceU/the-autocompletor/internal/model"
 )
 
-const maxDepth = 3
+const (
+	// DefaultMaxDepth is how many levels of subcommands are probed by default.
+	DefaultMaxDepth = 3
+	// DefaultConcurrency is the default number of help probes run at once.
+	DefaultConcurrency = 6
+	// DefaultProbeTimeout is the default time limit for a single help probe.
+	DefaultProbeTimeout = 5 * time.Second
+)
 
 // ProgressFunc is called whenever the parser starts processing a command.
 // Callers can use it to display progress (e.g. print to stderr).
 type ProgressFunc func(msg string)
 
+// Options configures a parse run.
+type Options struct {
+	// HelpStrategies is the ordered list of ways to ask for help. The first one
+	// that works on the root command is reused for the whole tree
+	// (default: DefaultHelpStrategies).
+	HelpStrategies []HelpStrategy
+	// KeepLocale runs probed programs in the user's locale instead of LC_ALL=C,
+	// for translated descriptions (section headers are only recognised in English).
+	KeepLocale bool
+	// Concurrency bounds the number of probes running at once across the
+	// whole tree (default: DefaultConcurrency).
+	Concurrency int
+	// Pool, if set, replaces Concurrency: parses sharing a pool are bounded
+	// together, e.g. when generating completions for many programs at once.
+	Pool Pool
+	// ProbeTimeout limits each help/man probe (default: DefaultProbeTimeout).
+	// An overall deadline is set on the context passed to Parse.
+	ProbeTimeout time.Duration
+	// MaxDepth limits how many levels of subcommands are probed
+	// (default: DefaultMaxDepth). Deeper subcommands are listed without flags.
+	MaxDepth int
+	// IgnoreSubcommands lists subcommand paths relative to the program, e.g.
+	// "stash drop", that are never probed and are left out of the tree.
+	IgnoreSubcommands []string
+	// HelpFile reads help output from a file, "-" for stdin, or a directory
+	// (help.txt for the program, <sub>/help.txt for each subcommand) instead
+	// of running the program. If HelpFile or ManFile is set nothing is executed.
+	HelpFile string
+	// ManFile reads the man page from a file or "-": roff source (optionally
+	// gzipped) or rendered text.
+	ManFile string
+	// Stdin is read for a "-" file (default: os.Stdin).
+	Stdin io.Reader
+	// NoNative skips the fish and zsh completion scripts installed for the
+	// program, which are otherwise merged into the parsed tree.
+	NoNative bool
+	// Diagnostics, if set, collects accepted and rejected lines for a report.
+	Diagnostics *Diagnostics
+	// Progress, if set, is called for each step.
+	Progress ProgressFunc
+}
+
+// Pool bounds the number of probes running at once.
+type Pool chan struct{}
+
+// NewPool returns a pool of n slots (DefaultConcurrency if n <= 0).
+func NewPool(n int) Pool {
+	if n <= 0 {
+		n = DefaultConcurrency
+	}
+	return make(Pool, n)
+}
+
 // Parse builds a Command tree for the given program by trying:
 // 1. man page
 // 2. --help output + recursive subcommand discovery
-func Parse(program string) (*model.Command, error) {
-	return ParseWithProgress(program, nil)
+// and merging in fish/zsh completion scripts installed for it.
+//
+// Cancelling ctx stops all running probes (and their child processes).
+func Parse(ctx context.Context, program string) (*model.Command, error) {
+	return ParseWithOptions(ctx, program, Options{})
 }
 
 // ParseWithProgress is like Parse but calls progress for each step.
-func ParseWithProgress(program string, progress ProgressFunc) (*model.Command, error) {
-	notify := func(msg string) {
-		if progress != nil {
-			progress(msg)
-		}
+func ParseWithProgress(ctx context.Context, program string, progress ProgressFunc) (*model.Command, error) {
+	return ParseWithOptions(ctx, program, Options{Progress: progress})
+}
+
+// ParseWithOptions is like Parse but configured by opts.
+// If ctx is cancelled or its deadline passes, ctx.Err() is returned.
+func ParseWithOptions(ctx context.Context, program string, opts Options) (*model.Command, error) {
+	if opts.HelpFile == "-" && opts.ManFile == "-" {
+		return nil, fmt.Errorf("only one of the help and man files can be read from stdin")
 	}
+	cmd, err := newHelpSession(opts).parseTree(ctx, program)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	return cmd, err
+}
 
-	notify(fmt.Sprintf("reading man page for %q", program))
-	manCmd, err := parseManPage(program)
+// ParseHelp parses help output for the given command path and recurses into subcommands.
+func ParseHelp(ctx context.Context, args ...string) (*model.Command, error) {
+	return newHelpSession(Options{}).parse(ctx, args)
+}
+
+// parseTree reads the man page and help output of program and merges in the
+// completion scripts already installed for it.
+func (s *helpSession) parseTree(ctx context.Context, program string) (*model.Command, error) {
+	cmd, err := s.parseScraped(ctx, program)
+	if s.noNative {
+		return cmd, err
+	}
+	native := s.parseNative(program)
+	if native == nil {
+		return cmd, err
+	}
+	if err != nil || cmd == nil {
+		return native, nil
+	}
+	mergeNative(cmd, native)
+	return cmd, nil
+}
+
+// parseScraped reads the man page and help output of program.
+func (s *helpSession) parseScraped(ctx context.Context, program string) (*model.Command, error) {
+	s.notify(fmt.Sprintf("reading man page for %q", program))
+	manCmd, err := s.parseManPage(ctx, program)
 	if err == nil && manCmd != nil && len(manCmd.Flags) > 0 {
-		notify(fmt.Sprintf("reading --help for %q", program))
-		helpCmd, herr := ParseHelp(program)
+		helpCmd, herr := s.parse(ctx, []string{program})
 		if herr == nil {
 			mergeSubcommands(manCmd, helpCmd)
+			if len(manCmd.Args) == 0 {
+				manCmd.Args = helpCmd.Args
+			}
 		}
+		manCmd.Subcommands = slices.DeleteFunc(manCmd.Subcommands, func(c *model.Command) bool {
+			return s.ignored(nil, c.Name)
+		})
 		for _, sub := range manCmd.Subcommands {
-			if len(sub.Flags) == 0 {
-				notify(fmt.Sprintf("reading --help for %q %q", program, sub.Name))
-				if subHelp, serr := ParseHelp(program, sub.Name); serr == nil {
+			if len(sub.Flags) == 0 && s.strategy != "" {
+				if subHelp, serr := s.parseRecursive(ctx, []string{program, sub.Name}, 1, ""); serr == nil {
 					sub.Flags = subHelp.Flags
+					sub.Args = subHelp.Args
 					if sub.Description == "" {
 						sub.Description = subHelp.Description
 					}
@@ -54,54 +159,167 @@ func ParseWithProgress(program string, progress ProgressFunc) (*model.Command, e
 		return manCmd, nil
 	}
 
-	notify(fmt.Sprintf("reading --help for %q", program))
-	return parseHelpRecursive([]string{program}, 0, "", notify)
+	return s.parse(ctx, []string{program})
+}
+
+// helpSession carries the state of one parse run through the recursive help
+// walk: the help strategy detected on the root is reused for every subcommand.
+type helpSession struct {
+	strategies []HelpStrategy
+	strategy   HelpStrategy
+	rootOutput string // help output captured while detecting the strategy
+	keepLocale bool
+	noNative   bool
+	diag       *Diagnostics
+	progress   ProgressFunc
+
+	files    *fileSource // set when help and man text come from files
+	maxDepth int
+	ignore   map[string]bool // subcommand paths without the program, e.g. "stash drop"
+
+	// pool bounds the number of probe processes running at once across the
+	// whole tree; timeout limits each of them.
+	pool    Pool
+	timeout time.Duration
+}
+
+func newHelpSession(opts Options) *helpSession {
+	strategies := opts.HelpStrategies
+	if len(strategies) == 0 {
+		strategies = DefaultHelpStrategies
+	}
+	pool := opts.Pool
+	if pool == nil {
+		pool = NewPool(opts.Concurrency)
+	}
+	timeout := opts.ProbeTimeout
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+	maxDepth := opts.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	ignore := map[string]bool{}
+	for _, p := range opts.IgnoreSubcommands {
+		ignore[strings.Join(strings.Fields(p), " ")] = true
+	}
+	var files *fileSource
+	if opts.HelpFile != "" || opts.ManFile != "" {
+		stdin := opts.Stdin
+		if stdin == nil {
+			stdin = os.Stdin
+		}
+		files = &fileSource{helpPath: opts.HelpFile, manPath: opts.ManFile, stdin: stdin}
+	}
+	return &helpSession{
+		strategies: strategies,
+		files:      files,
+		maxDepth:   maxDepth,
+		ignore:     ignore,
+		keepLocale: opts.KeepLocale,
+		noNative:   opts.NoNative,
+		diag:       opts.Diagnostics,
+		progress:   opts.Progress,
+		pool:       pool,
+		timeout:    timeout,
+	}
+}
+
+// ignored reports whether subcommand name under parent (a path without the
+// program) must not be probed.
+func (s *helpSession) ignored(parent []string, name string) bool {
+	return s.ignore[strings.Join(append(append([]string{}, parent...), name), " ")]
 }
 
-// ParseHelp parses --help output for the given command path and recurses into subcommands.
-func ParseHelp(args ...string) (*model.Command, error) {
-	return parseHelpRecursive(args, 0, "", nil)
+func (s *helpSession) notify(msg string) {
+	if s.progress != nil {
+		s.progress(msg)
+	}
+}
+
+// parse detects the help strategy on args[0] and walks the tree from args.
+func (s *helpSession) parse(ctx context.Context, args []string) (*model.Command, error) {
+	if s.strategy == "" && s.files != nil {
+		if s.files.helpPath == "" {
+			return nil, fmt.Errorf("no help file given")
+		}
+		s.notify(fmt.Sprintf("reading help file %s", s.files.helpPath))
+		out, err := s.files.help(nil)
+		if err != nil {
+			return nil, err
+		}
+		// Nothing is run; the strategy only marks the root as read.
+		s.strategy, s.rootOutput = HelpLongFlag, out
+	}
+	if s.strategy == "" {
+		s.notify(fmt.Sprintf("detecting help strategy for %q", args[0]))
+		st, out, err := s.detectHelpStrategy(ctx, args[0])
+		if err != nil {
+			return nil, err
+		}
+		s.strategy, s.rootOutput = st, out
+	}
+	return s.parseRecursive(ctx, args, 0, "")
 }
 
-// parseHelpRecursive recurses into subcommands.
+// parseRecursive recurses into subcommands.
 // parentOutput is the help output of the parent call; if a child returns the
 // same output we stop recursing (the program doesn't support per-subcommand help).
-func parseHelpRecursive(args []string, depth int, parentOutput string, progress ProgressFunc) (*model.Command, error) {
-	if depth > maxDepth {
+func (s *helpSession) parseRecursive(ctx context.Context, args []string, depth int, parentOutput string) (*model.Command, error) {
+	if depth > s.maxDepth {
 		return nil, fmt.Errorf("max depth reached")
 	}
-
-	if progress != nil {
-		progress(fmt.Sprintf("reading --help for %q", strings.Join(args, " ")))
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
 	program := args[0]
-	output, err := runHelp(args...)
-	if err != nil {
-		return nil, fmt.Errorf("could not get help for %q: %w", strings.Join(args, " "), err)
+	var output string
+	if len(args) == 1 && s.rootOutput != "" {
+		output = s.rootOutput
+	} else {
+		out, err := s.helpOutput(ctx, args)
+		if err != nil {
+			return nil, fmt.Errorf("could not get help for %q: %w", strings.Join(args, " "), err)
+		}
+		output = out
 	}
 
 	// If the output is identical to the parent's, this program doesn't have
 	// per-subcommand help — stop recursing to avoid combinatorial explosion.
 	if parentOutput != "" && normalizeHelp(output) == normalizeHelp(parentOutput) {
-		cmd := &model.Command{Name: args[len(args)-1]}
+		cmd := &model.Command{Name: args[len(args)-1], Source: model.SourceHelp}
 		return cmd, nil
 	}
 
-	cmd := &model.Command{Name: program}
+	cmd := &model.Command{Name: program, Source: model.SourceHelp, Confidence: 1}
 	if len(args) > 1 {
 		cmd.Name = args[len(args)-1]
 	}
 
+	log := s.diag.log(strings.Join(args, " "), model.SourceHelp)
 	lines := strings.Split(output, "\n")
-	cmd.Flags = extractFlags(lines)
-	subEntries := extractSubcommands(lines, false)
+	cmd.Flags = extractFlags(lines, model.SourceHelp, log)
+	cmd.Args = extractUsageArgs(lines)
+	if len(args) > 1 {
+		cmd.Aliases = extractAliases(lines, cmd.Name)
+	}
+	subEntries := extractSubcommands(lines, false, log)
+	subEntries = slices.DeleteFunc(subEntries, func(e subEntry) bool {
+		if s.ignored(args[1:], e.name) {
+			log.reject("subcommand", e.line, "in the ignore list")
+			return true
+		}
+		return false
+	})
 
 	if len(subEntries) == 0 {
 		return cmd, nil
 	}
 
-	// Resolve subcommands in parallel (bounded to 6 workers).
+	// Resolve subcommands in parallel; the number of probe processes running
+	// at once is bounded by the session-wide pool (see runHelpCommand).
 	type result struct {
 		index int
 		cmd   *model.Command
@@ -109,16 +327,12 @@ func parseHelpRecursive(args []string, depth int, parentOutput string, progress
 	}
 
 	results := make([]result, len(subEntries))
-	sem := make(chan struct{}, 6)
 	done := make(chan result, len(subEntries))
 
 	for i, entry := range subEntries {
-		i, entry := i, entry
-		sem <- struct{}{}
 		go func() {
-			defer func() { <-sem }()
 			subArgs := append(append([]string{}, args...), entry.name)
-			subCmd, serr := parseHelpRecursive(subArgs, depth+1, output, progress)
+			subCmd, serr := s.parseRecursive(ctx, subArgs, depth+1, output)
 			done <- result{index: i, cmd: subCmd, err: serr}
 		}()
 	}
@@ -134,13 +348,20 @@ func parseHelpRecursive(args []string, depth int, parentOutput string, progress
 		if r.err != nil {
 			cmd.Subcommands = append(cmd.Subcommands, &model.Command{
 				Name:        entry.name,
+				Aliases:     entry.aliases,
 				Description: entry.desc,
+				Source:      model.SourceHelp,
+				Line:        entry.line,
+				Confidence:  entry.confidence,
 			})
 			continue
 		}
+		r.cmd.Line = entry.line
+		r.cmd.Confidence = entry.confidence
 		if r.cmd.Description == "" {
 			r.cmd.Description = entry.desc
 		}
+		r.cmd.Aliases = mergeAliases(entry.aliases, r.cmd.Aliases)
 		cmd.Subcommands = append(cmd.Subcommands, r.cmd)
 	}
 
@@ -152,40 +373,117 @@ func normalizeHelp(s string) string {
 	return strings.TrimSpace(s)
 }
 
-// runHelp executes <args> --help, falling back to -h, with a timeout and pager disabled.
-func runHelp(args ...string) (string, error) {
-	for _, flag := range []string{"--help", "-h"} {
-		cmdArgs := append(args[1:], flag)
-
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		cmd := exec.CommandContext(ctx, args[0], cmdArgs...)
-		// Disable pagers so programs like git don't block waiting for interaction
-		cmd.Env = append(os.Environ(),
-			"PAGER=cat",
-			"GIT_PAGER=cat",
-			"MANPAGER=cat",
-			"TERM=dumb",
-			"GIT_TERMINAL_PROMPT=0",
-		)
-		out, _ := cmd.CombinedOutput()
-		cancel()
-
-		if len(out) > 0 {
-			return string(out), nil
-		}
+// helpOutput returns the help output of the (sub)command at args, from the
+// help directory if one was given, otherwise by running it.
+func (s *helpSession) helpOutput(ctx context.Context, args []string) (string, error) {
+	if s.files != nil {
+		return s.files.help(args[1:])
 	}
-	return "", fmt.Errorf("no help output for %q", strings.Join(args, " "))
+	s.notify(fmt.Sprintf("reading %q", strings.Join(append([]string{args[0]}, s.strategy.helpArgs(args)...), " ")))
+	return s.execHelp(ctx, args, s.strategy)
 }
 
-// mergeSubcommands copies subcommands from src into dst if not already present.
+// execHelp runs args with the given help strategy, with a timeout and pager disabled.
+// Programs run in the C locale unless keepLocale is set; if that yields no
+// output, the probe is retried in the user's locale.
+func (s *helpSession) execHelp(ctx context.Context, args []string, st HelpStrategy) (string, error) {
+	output := s.runHelpCommand(ctx, args, st, helpEnv(s.keepLocale))
+	if output == "" && !s.keepLocale && ctx.Err() == nil {
+		output = s.runHelpCommand(ctx, args, st, helpEnv(true))
+	}
+	if output == "" {
+		return "", fmt.Errorf("no help output for %q", strings.Join(args, " "))
+	}
+	return output, nil
+}
+
+// runHelpCommand runs one help probe and returns its normalised output, or ""
+// if it printed nothing (or ctx was cancelled while waiting for a pool slot).
+func (s *helpSession) runHelpCommand(ctx context.Context, args []string, st HelpStrategy, env []string) string {
+	out, _ := s.runProbe(ctx, env, args[0], st.helpArgs(args)...)
+
+	output := normalizeOutput(string(out))
+	if strings.TrimSpace(output) == "" {
+		return ""
+	}
+	return output
+}
+
+// runProbe runs a probe process once a pool slot is free, with the per-probe
+// timeout. The process runs in its own process group, which is killed as a
+// whole on timeout or cancellation so no grandchildren (pagers, man, col) survive.
+func (s *helpSession) runProbe(ctx context.Context, env []string, name string, arg ...string) ([]byte, error) {
+	select {
+	case s.pool <- struct{}{}:
+		defer func() { <-s.pool }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, arg...)
+	cmd.Env = env
+	setProcessGroup(cmd)
+	cmd.WaitDelay = time.Second
+	return cmd.CombinedOutput()
+}
+
+// helpColumns is the terminal (and man page) width reported to probed
+// programs, wide enough that flag tables don't wrap.
+const helpColumns = "200"
+
+// helpEnv returns the environment for probed programs: pagers and colours are
+// disabled so output is plain text and nothing blocks waiting for interaction.
+// Unless keepLocale is set, the C locale is forced so headers come out in English.
+func helpEnv(keepLocale bool) []string {
+	env := append(os.Environ(),
+		"PAGER=cat",
+		"GIT_PAGER=cat",
+		"MANPAGER=cat",
+		"TERM=dumb",
+		"GIT_TERMINAL_PROMPT=0",
+		"NO_COLOR=1",
+		"CLICOLOR=0",
+		"CLICOLOR_FORCE=0",
+		"FORCE_COLOR=0",
+		"COLUMNS="+helpColumns,
+		"MANWIDTH="+helpColumns,
+	)
+	if !keepLocale {
+		env = append(env, "LC_ALL=C", "LANG=C", "LANGUAGE=")
+	}
+	return env
+}
+
+// mergeSubcommands copies subcommands from src into dst if not already present
+// under any of their names.
 func mergeSubcommands(dst, src *model.Command) {
-	existing := map[string]bool{}
+	existing := map[string]*model.Command{}
 	for _, s := range dst.Subcommands {
-		existing[s.Name] = true
+		for _, n := range s.Names() {
+			existing[n] = s
+		}
 	}
 	for _, s := range src.Subcommands {
-		if !existing[s.Name] {
-			dst.Subcommands = append(dst.Subcommands, s)
+		if d, ok := existing[s.Name]; ok {
+			d.Aliases = mergeAliases(d.Aliases, s.Aliases)
+			continue
+		}
+		dst.Subcommands = append(dst.Subcommands, s)
+	}
+}
+
+// mergeAliases returns the union of two alias lists, preserving order.
+func mergeAliases(a, b []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, n := range append(append([]string{}, a...), b...) {
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
 		}
 	}
+	return out
 }
@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+	"github.com/TerenceU/the-autocompletor/internal/overrides"
+)
+
+// fakeProgram writes a shell script named name that prints the fixture
+// files of dir: help.txt for "help", <sub>/help.txt for "help <sub>", and
+// fails like an unknown command otherwise.
+func fakeProgram(t *testing.T, name, dir string) string {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("needs sh")
+	}
+	abs, err := filepath.Abs(filepath.Join("testdata", dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	script := `#!/bin/sh
+if [ "$1" = help ] && [ $# -eq 1 ]; then cat '` + abs + `/help.txt'; exit 0; fi
+if [ "$1" = help ] && [ -f '` + abs + `'/"$2"/help.txt ]; then cat '` + abs + `'/"$2"/help.txt; exit 0; fi
+echo "` + name + ` $*: unknown command" >&2
+exit 2
+`
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func subcommand(cmd *model.Command, name string) *model.Command {
+	for _, sub := range cmd.Subcommands {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+func hasFlag(cmd *model.Command, spelling string) bool {
+	return slices.ContainsFunc(cmd.Flags, func(f model.Flag) bool {
+		return f.Long == spelling || f.Short == spelling || f.Old == spelling
+	})
+}
+
+// TestGoOverride runs a program answering like "go help" with the options
+// of the shipped go override.
+func TestGoOverride(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir()) // shipped overrides only
+	set, err := overrides.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := set.For("/usr/local/go/bin/go")
+	if o == nil {
+		t.Fatal("no shipped override for go")
+	}
+	var strategies []HelpStrategy
+	for _, s := range o.HelpStrategy {
+		st, err := ParseHelpStrategy(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		strategies = append(strategies, st)
+	}
+
+	program := fakeProgram(t, "go", "go")
+	cmd, err := ParseWithOptions(context.Background(), program, Options{
+		HelpStrategies: strategies,
+		MaxDepth:       o.MaxDepth,
+		NoNative:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"build", "mod", "test", "vet"} {
+		if subcommand(cmd, name) == nil {
+			t.Errorf("missing subcommand %q", name)
+		}
+	}
+	if subcommand(cmd, "buildmode") != nil {
+		t.Error("help topic buildmode listed as a subcommand")
+	}
+	build := subcommand(cmd, "build")
+	if build == nil {
+		t.FailNow()
+	}
+	for _, f := range []string{"-C", "-a", "-race", "-ldflags"} {
+		if !hasFlag(build, f) {
+			t.Errorf("go build: missing flag %s", f)
+		}
+	}
+}
+
+// TestParseNative reads the fish and zsh scripts of a program from the
+// per-user completion directories under $XDG_DATA_HOME, skipping scripts
+// generated by theautocompletor.
+func TestParseNative(t *testing.T) {
+	data := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", data)
+	t.Setenv("HOME", t.TempDir())
+	install := func(dir, fixture, name string) {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join("testdata", "native", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(data, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(data, dir, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	install("fish/vendor_completions.d", "tacdemo.fish", "tacdemo.fish")
+	install("zsh/site-functions", "_tacdemo", "_tacdemo")
+
+	s := newHelpSession(Options{})
+	cmd := s.parseNative("/usr/bin/tacdemo")
+	if cmd == nil {
+		t.Fatal("no native completions found")
+	}
+	for _, f := range []string{"--verbose", "-v", "--color", "--quiet", "-q"} {
+		if !hasFlag(cmd, f) {
+			t.Errorf("missing flag %s", f)
+		}
+	}
+	add := subcommand(cmd, "add")
+	if add == nil || subcommand(cmd, "remove") == nil {
+		t.Fatalf("subcommands = %v, want add and remove", cmd.Subcommands)
+	}
+	if !hasFlag(add, "--force") {
+		t.Error("add: missing flag --force")
+	}
+
+	// A script of our own is not a native source
+	generated := "# Fish completions for tacdemo (generated by theautocompletor)\ncomplete -c tacdemo -l generated\n"
+	if err := os.WriteFile(filepath.Join(data, "fish/vendor_completions.d/tacdemo.fish"), []byte(generated), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := s.parseNative("tacdemo"); cmd == nil || hasFlag(cmd, "--generated") {
+		t.Error("read back a generated script")
+	}
+}
+
+// TestHelpFiles parses a program from a help directory and a roff man page
+// instead of running it.
+func TestHelpFiles(t *testing.T) {
+	cmd, err := ParseWithOptions(context.Background(), "tool", Options{
+		HelpFile: filepath.Join("testdata", "tool"),
+		ManFile:  filepath.Join("testdata", "roff", "demo.1"),
+		NoNative: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"--verbose", "--quiet", "-C"} {
+		if !hasFlag(cmd, f) {
+			t.Errorf("missing flag %s", f)
+		}
+	}
+	run := subcommand(cmd, "run")
+	if run == nil {
+		t.Fatal("missing subcommand run")
+	}
+	if !hasFlag(run, "--dry-run") {
+		t.Error("run: missing flag --dry-run")
+	}
+}
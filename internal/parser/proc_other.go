@@ -0,0 +1,9 @@
+//go:build !unix
+
+package parser
+
+import "os/exec"
+
+// setProcessGroup is a no-op where process groups aren't available;
+// cancellation kills only the direct child.
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,266 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// roffEscapePattern matches the roff escapes that don't produce text: font
+// and size changes, string interpolation, zero-width and spacing escapes.
+var roffEscapePattern = regexp.MustCompile(`\\f(?:\[[^\]]*\]|\(..|.)|\\s[+-]?\d+|\\\*(?:\[[^\]]*\]|\(..|.)|\\[&%|^c]`)
+
+// roffGlyphs maps named roff glyphs to plain text.
+var roffGlyphs = strings.NewReplacer(
+	`\-`, "-", `\(em`, "—", `\(en`, "-", `\(hy`, "-", `\(mi`, "-",
+	`\(aq`, "'", `\(lq`, `"`, `\(rq`, `"`, `\(oq`, "'", `\(cq`, "'",
+	`\(bu`, "•", `\(co`, "©", `\e`, `\`, `\ `, " ", `\~`, " ", `\0`, " ",
+	`\(ga`, "`", `\(ti`, "~", `\(ha`, "^", `\(dq`, `"`,
+)
+
+// Indentation of rendered man pages, as printed by man(1).
+const (
+	roffBodyIndent = 7
+	roffTagIndent  = 7
+	roffDescIndent = 14
+)
+
+// looksLikeRoff reports whether text is roff source (man or mdoc macros)
+// rather than an already rendered page.
+func looksLikeRoff(text string) bool {
+	for _, line := range strings.SplitN(text, "\n", 50) {
+		for _, macro := range []string{".TH ", ".SH ", ".Dd ", ".Sh ", ".Dt "} {
+			if strings.HasPrefix(line, macro) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// renderRoff turns man(7) or mdoc(7) source into text laid out like the
+// output of "man | col -bx": section titles flush left, paragraphs indented
+// and filled into one line each, and tagged paragraphs (.TP, .IP, .It) with
+// the tag on its own line and the description below. Only the macros that
+// matter for flag and subcommand extraction are understood; others are
+// dropped or rendered as plain words.
+func renderRoff(src string) string {
+	var out []string
+	var para []string // words of the paragraph being filled
+	indent := roffBodyIndent
+	base := roffBodyIndent // indent of the current paragraph type, before .RS
+	tagNext := false       // the next text line is a .TP tag
+	noFill := false        // .nf/.EX: lines are kept as they are
+	name := ""             // .Nm value for mdoc pages
+	section := ""          // title of the current .SH
+
+	// flush ends the paragraph being filled (a break).
+	flush := func() {
+		if len(para) > 0 {
+			out = append(out, strings.Repeat(" ", indent)+strings.Join(para, " "))
+			para = nil
+		}
+	}
+	emit := func(text string) {
+		switch {
+		case tagNext:
+			flush()
+			out = append(out, strings.Repeat(" ", indent-base+roffTagIndent)+strings.TrimSpace(text))
+			tagNext = false
+		case noFill:
+			flush()
+			out = append(out, strings.Repeat(" ", indent)+text)
+		case strings.TrimSpace(text) != "":
+			para = append(para, strings.TrimSpace(text))
+		}
+	}
+
+	for _, line := range strings.Split(src, "\n") {
+		if strings.HasPrefix(line, `.\"`) || strings.HasPrefix(line, `'\"`) || line == "." {
+			continue
+		}
+		if !strings.HasPrefix(line, ".") && !strings.HasPrefix(line, "'") {
+			text := roffText(line)
+			if strings.TrimSpace(text) != "" {
+				emit(text)
+			} else if !tagNext {
+				// A blank line is a break and an empty line
+				flush()
+				out = append(out, "")
+			}
+			continue
+		}
+
+		macro, rest, _ := strings.Cut(strings.TrimSpace(line[1:]), " ")
+		args := roffArgs(rest)
+		// Each .Nm of an mdoc SYNOPSIS starts a new line
+		if !roffInline(macro) || macro == "Nm" && section == "SYNOPSIS" {
+			flush()
+		}
+		switch macro {
+		case "SH", "Sh":
+			section = strings.ToUpper(strings.Join(args, " "))
+			out = append(out, "", section)
+			indent, base, tagNext = roffBodyIndent, roffBodyIndent, false
+		case "SS", "Ss":
+			out = append(out, "", "   "+strings.Join(args, " "))
+			indent, base, tagNext = roffBodyIndent, roffBodyIndent, false
+		case "PP", "LP", "P", "Pp":
+			out = append(out, "")
+			indent -= base - roffBodyIndent
+			base = roffBodyIndent
+		case "TP":
+			out = append(out, "")
+			indent += roffDescIndent - base
+			base = roffDescIndent
+			tagNext = true
+		case "IP":
+			out = append(out, "")
+			indent += roffDescIndent - base
+			base = roffDescIndent
+			if len(args) > 0 && args[0] != "" {
+				out = append(out, strings.Repeat(" ", indent-base+roffTagIndent)+roffText(args[0]))
+			}
+		case "It":
+			out = append(out, "")
+			indent += roffDescIndent - base
+			base = roffDescIndent
+			if tag := mdocText(args, name); tag != "" {
+				out = append(out, strings.Repeat(" ", indent-base+roffTagIndent)+tag)
+			}
+		case "RS":
+			indent += roffBodyIndent
+		case "RE":
+			indent = max(indent-roffBodyIndent, base)
+		case "sp":
+			out = append(out, "")
+		case "nf", "EX":
+			noFill = true
+		case "fi", "EE":
+			noFill = false
+		case "B", "I", "SM", "SB":
+			emit(roffText(strings.Join(args, " ")))
+		case "BR", "RB", "BI", "IB", "IR", "RI":
+			// Alternating fonts: the arguments are joined without spaces.
+			emit(roffText(strings.Join(args, "")))
+		case "Nm":
+			if name == "" && len(args) > 0 {
+				name = args[0]
+			}
+			emit(mdocText(append([]string{"Nm"}, args...), name))
+		case "Nd":
+			emit("- " + strings.Join(args, " "))
+		case "Fl", "Ar", "Op", "Cm", "Xo", "Ic", "Sy", "Em", "Li", "Pa", "Va", "Ev":
+			emit(mdocText(append([]string{macro}, args...), name))
+		}
+		// Everything else (.TH, .Dd, .Bl, .El, .br, .in, ...) is layout
+		// that doesn't affect extraction, apart from the break.
+	}
+	flush()
+	return strings.Join(out, "\n") + "\n"
+}
+
+// roffInline reports whether macro produces text within the current
+// paragraph instead of breaking it.
+func roffInline(macro string) bool {
+	switch macro {
+	case "B", "I", "SM", "SB", "BR", "RB", "BI", "IB", "IR", "RI",
+		"Nm", "Nd", "Fl", "Ar", "Op", "Cm", "Xo", "Ic", "Sy", "Em", "Li", "Pa", "Va", "Ev":
+		return true
+	}
+	return false
+}
+
+// roffText renders the escapes of one line of roff text.
+func roffText(s string) string {
+	s = roffEscapePattern.ReplaceAllString(s, "")
+	s = roffGlyphs.Replace(s)
+	return strings.ReplaceAll(s, `\\`, `\`)
+}
+
+// roffArgs splits macro arguments, honouring double quotes.
+func roffArgs(s string) []string {
+	var args []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] == '"' {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				args = append(args, s[1:])
+				break
+			}
+			args = append(args, s[1:end+1])
+			s = s[end+2:]
+			continue
+		}
+		word, rest, _ := strings.Cut(s, " ")
+		args = append(args, word)
+		s = rest
+	}
+	return args
+}
+
+// mdocText renders a line of mdoc inline macros: "Fl v Ar file" → "-v file",
+// "Op Fl n Ar count" → "[-n count]".
+func mdocText(words []string, name string) string {
+	var parts []string
+	open := 0
+	noSpace := false
+	add := func(s string) {
+		if noSpace && len(parts) > 0 {
+			parts[len(parts)-1] += s
+		} else {
+			parts = append(parts, s)
+		}
+		noSpace = false
+	}
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		switch w {
+		case "Fl":
+			// "Fl" followed by a non-macro word prefixes it with "-";
+			// "Fl -long" renders as "--long".
+			if i+1 < len(words) && !isMdocMacro(words[i+1]) {
+				i++
+				add("-" + roffText(words[i]))
+			} else {
+				add("-")
+				noSpace = true
+			}
+		case "Op", "Oo":
+			add("[")
+			noSpace = true
+			open++
+		case "Oc":
+			if len(parts) > 0 {
+				parts[len(parts)-1] += "]"
+				open--
+			}
+		case "Nm":
+			if i+1 < len(words) && !isMdocMacro(words[i+1]) {
+				i++
+				add(words[i])
+			} else {
+				add(name)
+			}
+		case "Ns":
+			noSpace = true
+		case "Ar", "Cm", "Ic", "Sy", "Em", "Li", "Pa", "Va", "Ev", "Xo", "Xc", "Dq", "Qq", "Sq", "Pq":
+			// Font and quoting macros: keep only their arguments.
+		default:
+			add(roffText(w))
+		}
+	}
+	text := strings.Join(parts, " ")
+	if open > 0 {
+		text += strings.Repeat("]", open)
+	}
+	return strings.ReplaceAll(text, "[ ", "[")
+}
+
+// isMdocMacro reports whether w is an mdoc inline macro name (Fl, Ar, Ns, ...).
+func isMdocMacro(w string) bool {
+	switch w {
+	case "Fl", "Ar", "Op", "Oo", "Oc", "Nm", "Ns", "Cm", "Ic", "Sy", "Em", "Li", "Pa", "Va", "Ev", "Xo", "Xc", "Dq", "Qq", "Sq", "Pq":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files under testdata")
+
+// TestRenderRoff compares rendered pages with the golden files next to them
+// (go test -update rewrites them).
+func TestRenderRoff(t *testing.T) {
+	for _, page := range []string{"roff/demo.1", "roff/demo.8"} {
+		src, err := os.ReadFile(filepath.Join("testdata", page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !looksLikeRoff(string(src)) {
+			t.Errorf("%s: not detected as roff", page)
+		}
+		got := renderRoff(string(src))
+		golden := filepath.Join("testdata", page+".txt")
+		if *update {
+			if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != string(want) {
+			t.Errorf("%s: rendered differently from %s:\n%s", page, golden, lineDiff(string(want), got))
+		}
+	}
+}
+
+// TestRoffWrappedDescriptions checks that descriptions wrapped in the source
+// reach the flags whole.
+func TestRoffWrappedDescriptions(t *testing.T) {
+	tests := []struct {
+		page, flag, desc string
+	}{
+		{"roff/demo.1", "-v", "Print more output, one line for each file processed."},
+		{"roff/demo.1", "-C", "Run as if demo was started in path instead of the current working directory."},
+		{"roff/demo.1", "--config-env", "Like -c, but the value is read from the environment variable envvar."},
+		{"roff/demo.1", "-q", "Print nothing."},
+		{"roff/demo.8", "-f", "Read the configuration from file instead of the default location."},
+		{"roff/demo.8", "-n", "Dry run: print what would be done."},
+	}
+	rendered := map[string][]string{}
+	for _, tt := range tests {
+		lines, ok := rendered[tt.page]
+		if !ok {
+			src, err := os.ReadFile(filepath.Join("testdata", tt.page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines = strings.Split(renderRoff(string(src)), "\n")
+			rendered[tt.page] = lines
+		}
+		cmd := &model.Command{Flags: extractFlags(lines, model.SourceMan, nil)}
+		var got *model.Flag
+		for i, f := range cmd.Flags {
+			if f.Short == tt.flag || f.Long == tt.flag {
+				got = &cmd.Flags[i]
+			}
+		}
+		if got == nil {
+			t.Errorf("%s: flag %s not found", tt.page, tt.flag)
+			continue
+		}
+		if !strings.HasPrefix(got.Description, tt.desc) {
+			t.Errorf("%s: %s description = %q, want %q", tt.page, tt.flag, got.Description, tt.desc)
+		}
+	}
+}
+
+// lineDiff shows the lines of want and got that differ.
+func lineDiff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var b strings.Builder
+	for i := range max(len(w), len(g)) {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			b.WriteString("-" + wl + "\n+" + gl + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// HelpStrategy describes how a command is asked for its help output.
+type HelpStrategy string
+
+const (
+	HelpLongFlag   HelpStrategy = "--help" // prog sub --help
+	HelpShortFlag  HelpStrategy = "-h"     // prog sub -h
+	HelpSubcommand HelpStrategy = "help"   // prog help sub (go, git, cargo, hg)
+	HelpSingleDash HelpStrategy = "-help"  // prog sub -help (Go flag package)
+)
+
+// DefaultHelpStrategies is the order in which strategies are tried on the root command.
+var DefaultHelpStrategies = []HelpStrategy{HelpLongFlag, HelpShortFlag, HelpSubcommand, HelpSingleDash}
+
+// ParseHelpStrategy validates and returns a HelpStrategy from a user-provided string.
+func ParseHelpStrategy(s string) (HelpStrategy, error) {
+	for _, st := range DefaultHelpStrategies {
+		if string(st) == s {
+			return st, nil
+		}
+	}
+	return "", fmt.Errorf("unknown help strategy %q (supported: --help, -h, help, -help)", s)
+}
+
+// helpArgs returns the argv (without the program) that asks args for help.
+func (st HelpStrategy) helpArgs(args []string) []string {
+	switch st {
+	case HelpSubcommand:
+		return append([]string{"help"}, args[1:]...)
+	default:
+		return append(append([]string{}, args[1:]...), string(st))
+	}
+}
+
+// helpErrorPattern matches output that complains about the help request itself
+// rather than printing help (e.g. a program that doesn't understand --help).
+var helpErrorPattern = regexp.MustCompile(`(?i)(unknown (option|flag|command|argument)|unrecognized (option|command|argument)|invalid (option|command)|illegal option|flag provided but not defined|unexpected argument|no such (option|command))`)
+
+// looksLikeHelpError reports whether the first lines of output look like an
+// error about the help flag/subcommand rather than actual help text.
+func looksLikeHelpError(output string) bool {
+	lines := strings.SplitN(output, "\n", 4)
+	if len(lines) > 3 {
+		lines = lines[:3]
+	}
+	return helpErrorPattern.MatchString(strings.Join(lines, "\n"))
+}
+
+// helpSubcommandHint builds a pattern for root output that points users at
+// "prog help <command>" for per-subcommand details (go, git, cargo).
+func helpSubcommandHint(program string) *regexp.Regexp {
+	return regexp.MustCompile(`\b` + regexp.QuoteMeta(filepath.Base(program)) + `\s+help\s+[<\[]`)
+}
+
+// detectHelpStrategy tries strategies in order on the root command and returns
+// the one to reuse for the whole tree, together with the root's help output.
+// A strategy "works" if it prints output that doesn't look like an error; if
+// none does, the first one with any output is used. If the root help recommends
+// "prog help <command>" and that strategy is allowed, it is preferred for the tree.
+func (s *helpSession) detectHelpStrategy(ctx context.Context, program string) (HelpStrategy, string, error) {
+	var fallback HelpStrategy
+	var fallbackOutput string
+	var chosen HelpStrategy
+	var output string
+
+	for _, st := range s.strategies {
+		out, err := s.execHelp(ctx, []string{program}, st)
+		if err != nil {
+			continue
+		}
+		if !looksLikeHelpError(out) {
+			chosen, output = st, out
+			break
+		}
+		if fallback == "" {
+			fallback, fallbackOutput = st, out
+		}
+	}
+	if chosen == "" {
+		if fallback == "" {
+			return "", "", fmt.Errorf("no help output for %q", program)
+		}
+		chosen, output = fallback, fallbackOutput
+	}
+
+	if chosen != HelpSubcommand && helpSubcommandHint(program).MatchString(output) {
+		for _, st := range s.strategies {
+			if st == HelpSubcommand {
+				return HelpSubcommand, output, nil
+			}
+		}
+	}
+	return chosen, output, nil
+}
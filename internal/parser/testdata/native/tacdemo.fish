@@ -0,0 +1,7 @@
+# fish completions shipped with tacdemo
+complete -c tacdemo -f
+complete -c tacdemo -n __fish_use_subcommand -a add -d 'Add a file'
+complete -c tacdemo -n __fish_use_subcommand -a remove -d 'Remove a file'
+complete -c tacdemo -s v -l verbose -d 'Be verbose'
+complete -c tacdemo -l color -x -a 'always never auto' -d 'When to use colours'
+complete -c tacdemo -n '__fish_seen_subcommand_from add' -s f -l force -d 'Overwrite'
@@ -0,0 +1,331 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+// usageLinePattern matches "Usage: prog ..." / "USAGE:" lines (the rest may be empty
+// when the usage lines follow on their own, as in cobra and clap output).
+var usageLinePattern = regexp.MustCompile(`(?i)^\s*usage:\s*(.*)$`)
+
+// usageOrPattern matches coreutils-style alternative usage lines ("  or:  cp ...").
+var usageOrPattern = regexp.MustCompile(`(?i)^\s+or:\s*(.+)$`)
+
+// placeholderPattern matches an all-uppercase placeholder word like FILE or MIN_LEN.
+var placeholderPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_\-]*$`)
+
+// looseArgNamePattern matches argument names listed in an "Arguments:" section,
+// where argparse prints them in lowercase.
+var looseArgNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_\-]*$`)
+
+// extractUsageArgs parses the "Usage:" lines and the "Arguments:" /
+// "Positional arguments:" section of --help output and returns the
+// positional arguments in order.
+func extractUsageArgs(lines []string) []model.Arg {
+	sectionArgs := extractArgumentsSection(lines)
+
+	known := map[string]bool{}
+	for _, a := range sectionArgs {
+		known[a.Name] = true
+	}
+
+	var args []model.Arg
+	for _, usage := range collectUsageLines(lines) {
+		if args = parseUsageLine(usage, known); len(args) > 0 {
+			break // first usage line that names arguments wins
+		}
+	}
+
+	if len(args) == 0 {
+		return sectionArgs
+	}
+
+	// Fill descriptions (and choices) from the Arguments section.
+	byName := map[string]model.Arg{}
+	for _, a := range sectionArgs {
+		byName[a.Name] = a
+	}
+	for i, a := range args {
+		if s, ok := byName[a.Name]; ok {
+			args[i].Description = s.Description
+			if len(a.Choices) == 0 {
+				args[i].Choices = s.Choices
+			}
+		}
+	}
+	return args
+}
+
+// collectUsageLines returns the usage lines of a help output, joining lines
+// that wrap onto the next (more indented) line.
+func collectUsageLines(lines []string) []string {
+	var usages []string
+	for i := 0; i < len(lines); i++ {
+		m := usageLinePattern.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		rest := strings.TrimSpace(m[1])
+		headerIndent := indentOf(lines[i])
+
+		if rest == "" {
+			// "Usage:" on its own line: each following indented line is a usage line.
+			for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" && indentOf(lines[i+1]) > headerIndent {
+				i++
+				usages = append(usages, strings.TrimSpace(lines[i]))
+			}
+			continue
+		}
+
+		cur := rest
+		for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" && indentOf(lines[i+1]) > headerIndent {
+			i++
+			if om := usageOrPattern.FindStringSubmatch(lines[i]); om != nil {
+				usages = append(usages, cur)
+				cur = strings.TrimSpace(om[1])
+				continue
+			}
+			cur += " " + strings.TrimSpace(lines[i])
+		}
+		usages = append(usages, cur)
+	}
+	return usages
+}
+
+// parseUsageLine extracts positional arguments from a single usage line such as
+// "prog [OPTIONS] <path>... [ARGS]...". Literal words (the program name and
+// subcommand path) and flags are skipped unless they name an argument listed in
+// known (argparse prints lowercase names); parsing stops at a command placeholder
+// because whatever follows belongs to the subcommand.
+func parseUsageLine(usage string, known map[string]bool) []model.Arg {
+	var args []model.Arg
+	seen := map[string]bool{}
+	for _, tok := range splitUsageTokens(usage) {
+		if isCommandPlaceholder(tok) {
+			break
+		}
+		loose := known[normalizeArgName(strings.Trim(tok, "[]."))]
+		for _, a := range parseUsageToken(tok, false, loose) {
+			if seen[a.Name] || isMetaArg(a.Name) {
+				continue
+			}
+			seen[a.Name] = true
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+// splitUsageTokens splits a usage string on whitespace that is not enclosed in
+// brackets, so "[--output FILE]" and "{start | stop}" stay single tokens.
+// A standalone "..." is attached to the preceding token.
+func splitUsageTokens(s string) []string {
+	var tokens []string
+	var cur strings.Builder
+	depth := 0
+
+	flush := func() {
+		if cur.Len() == 0 {
+			return
+		}
+		tok := cur.String()
+		cur.Reset()
+		if tok == "..." && len(tokens) > 0 {
+			tokens[len(tokens)-1] += tok
+			return
+		}
+		tokens = append(tokens, tok)
+	}
+
+	for _, r := range s {
+		switch r {
+		case '[', '<', '{', '(':
+			depth++
+		case ']', '>', '}', ')':
+			if depth > 0 {
+				depth--
+			}
+		}
+		if depth == 0 && (r == ' ' || r == '\t') {
+			flush()
+			continue
+		}
+		cur.WriteRune(r)
+	}
+	flush()
+	return tokens
+}
+
+// parseUsageToken turns one usage token into zero or more arguments.
+// When loose is true (Arguments sections), bare lowercase words are accepted as
+// argument names instead of being treated as literals.
+func parseUsageToken(tok string, optional, loose bool) []model.Arg {
+	variadic := false
+	if strings.HasSuffix(tok, "...") {
+		variadic = true
+		tok = strings.TrimSuffix(tok, "...")
+	}
+	if tok == "" || strings.HasPrefix(tok, "-") {
+		return nil
+	}
+
+	mark := func(args []model.Arg) []model.Arg {
+		for i := range args {
+			args[i].Optional = args[i].Optional || optional
+			args[i].Variadic = args[i].Variadic || variadic
+		}
+		return args
+	}
+
+	switch {
+	case enclosedBy(tok, '[', ']'):
+		inner := strings.TrimSpace(tok[1 : len(tok)-1])
+		if strings.HasPrefix(inner, "-") {
+			return nil // optional flag group: [-v], [--output FILE], [-a | -b]
+		}
+		var args []model.Arg
+		for _, t := range splitUsageTokens(inner) {
+			args = append(args, parseUsageToken(t, true, loose)...)
+		}
+		return mark(args)
+
+	case enclosedBy(tok, '{', '}') || enclosedBy(tok, '(', ')'):
+		return mark(parseAlternation(tok[1 : len(tok)-1]))
+
+	case strings.Contains(tok, "|"):
+		return mark(parseAlternation(tok))
+
+	case enclosedBy(tok, '<', '>'):
+		return mark([]model.Arg{{Name: normalizeArgName(tok[1 : len(tok)-1])}})
+
+	case placeholderPattern.MatchString(tok), loose && looseArgNamePattern.MatchString(tok):
+		return mark([]model.Arg{{Name: normalizeArgName(tok)}})
+	}
+	return nil // literal word: program name or subcommand path
+}
+
+// parseAlternation handles "start|stop", "{a,b}" and "<file>|<dir>".
+// Literal members become Choices; if every member is a placeholder the
+// alternation is a single argument named after its members.
+func parseAlternation(s string) []model.Arg {
+	sep := "|"
+	if !strings.Contains(s, "|") {
+		sep = ","
+	}
+
+	var choices, names []string
+	for _, member := range strings.Split(s, sep) {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+		if strings.HasPrefix(member, "-") {
+			return nil // flag alternation like (-a|-b)
+		}
+		switch {
+		case enclosedBy(member, '<', '>'):
+			names = append(names, normalizeArgName(member[1:len(member)-1]))
+		case placeholderPattern.MatchString(member):
+			names = append(names, normalizeArgName(member))
+		default:
+			choices = append(choices, member)
+		}
+	}
+
+	switch {
+	case len(choices) > 0:
+		return []model.Arg{{Name: strings.Join(append(names, choices...), "|"), Choices: choices}}
+	case len(names) > 0:
+		return []model.Arg{{Name: strings.Join(names, "|")}}
+	}
+	return nil
+}
+
+// extractArgumentsSection parses "Arguments:" / "Positional arguments:" sections:
+//
+//	Arguments:
+//	  <FILE>...  Files to process
+//	  {a,b}      Mode to run in
+func extractArgumentsSection(lines []string) []model.Arg {
+	var args []model.Arg
+	seen := map[string]bool{}
+	inSection := false
+	sectionIndent := -1
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if indentOf(line) <= 4 && isArgumentsHeader(strings.ToLower(trimmed)) {
+			inSection = true
+			sectionIndent = -1
+			continue
+		}
+		if !inSection || trimmed == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			inSection = false
+			continue
+		}
+
+		lineIndent := indentOf(line)
+		if sectionIndent == -1 {
+			sectionIndent = lineIndent
+		}
+		if lineIndent > sectionIndent {
+			continue // wrapped description
+		}
+
+		parts := twoSpacesSplit.Split(trimmed, 2)
+		desc := ""
+		if len(parts) > 1 {
+			desc = strings.TrimSpace(parts[1])
+		}
+		for _, a := range parseUsageToken(parts[0], false, true) {
+			if seen[a.Name] {
+				continue
+			}
+			seen[a.Name] = true
+			a.Description = desc
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+func isArgumentsHeader(s string) bool {
+	// s is already trimmed and lowercased.
+	return s == "arguments:" ||
+		s == "arguments" ||
+		s == "args:" ||
+		s == "positional arguments:" ||
+		s == "positional arguments"
+}
+
+// isCommandPlaceholder reports whether a usage token stands for a subcommand.
+func isCommandPlaceholder(tok string) bool {
+	name := strings.ToLower(strings.Trim(tok, "[]<>{}()."))
+	return name == "command" || name == "subcommand" || name == "cmd"
+}
+
+// isMetaArg reports whether an argument name is a placeholder for options
+// rather than a real positional argument.
+func isMetaArg(name string) bool {
+	switch name {
+	case "options", "option", "flags", "flag", "global-options", "global-flags":
+		return true
+	}
+	return false
+}
+
+// normalizeArgName lowercases a placeholder and joins words with hyphens:
+// "charset string" → "charset-string", "FILE" → "file".
+func normalizeArgName(s string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), " ", "-"))
+}
+
+func enclosedBy(s string, open, close byte) bool {
+	return len(s) >= 2 && s[0] == open && s[len(s)-1] == close
+}
@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+// argSpec writes a as it would appear in a usage line: <name>, [name]...,
+// {a|b}.
+func argSpec(a model.Arg) string {
+	s := "<" + a.Name + ">"
+	if len(a.Choices) > 0 {
+		s = "{" + strings.Join(a.Choices, "|") + "}"
+	}
+	if a.Optional {
+		s = "[" + strings.Trim(s, "<>") + "]"
+	}
+	if a.Variadic {
+		s += "..."
+	}
+	return s
+}
+
+func argSpecs(args []model.Arg) []string {
+	specs := []string{}
+	for _, a := range args {
+		specs = append(specs, argSpec(a))
+	}
+	return specs
+}
+
+func TestExtractUsageArgs(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []string
+		desc    string // description of the first argument, if any
+	}{
+		// GNU: the first of the "or:" lines that names arguments wins
+		{"usage/gnu.txt", []string{"<source>", "<dest>"}, ""},
+		// clap: <REQUIRED>, [OPTIONAL]..., described in "Arguments:"
+		{"usage/clap.txt", []string{"<pattern>", "[path]..."}, "A regular expression used for searching"},
+		// argparse: lowercase names and {a,b,c} choices from "positional arguments:"
+		{"usage/argparse.txt", []string{"{start|stop|restart}", "<name>", "[extra]..."}, "What to do with the service"},
+		// cobra: "Usage:" on its own line, "[flags]" is not an argument
+		{"usage/cobra.txt", []string{"[name]", "[chart]"}, ""},
+		// init scripts: {a|b|c} alternation
+		{"usage/init.txt", []string{"{start|stop|status}", "<service>..."}, ""},
+		// Everything after <COMMAND> belongs to the subcommand
+		{"usage/subcommand.txt", []string{}, ""},
+	}
+	for _, tt := range tests {
+		args := extractUsageArgs(readFixture(t, tt.fixture))
+		if got := argSpecs(args); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: args = %v, want %v", tt.fixture, got, tt.want)
+			continue
+		}
+		if tt.desc != "" && args[0].Description != tt.desc {
+			t.Errorf("%s: description = %q, want %q", tt.fixture, args[0].Description, tt.desc)
+		}
+	}
+}
+
+// TestSubcommandArgs checks that positional arguments are read from the
+// help of each subcommand, not only from the root.
+func TestSubcommandArgs(t *testing.T) {
+	strategy, err := ParseHelpStrategy("help")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := ParseWithOptions(context.Background(), fakeProgram(t, "tool", "tool"), Options{
+		HelpStrategies: []HelpStrategy{strategy},
+		NoNative:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmd.Args) != 0 {
+		t.Errorf("root args = %v, want none", argSpecs(cmd.Args))
+	}
+	run := subcommand(cmd, "run")
+	if run == nil {
+		t.Fatal("missing subcommand run")
+	}
+	if got, want := argSpecs(run.Args), []string{"<task>", "[args]..."}; !slices.Equal(got, want) {
+		t.Errorf("run args = %v, want %v", got, want)
+	}
+	if !hasFlag(run, "--dry-run") {
+		t.Error("run: missing flag --dry-run")
+	}
+}
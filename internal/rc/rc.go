@@ -0,0 +1,270 @@
+// Package rc checks whether a shell actually loads completions from the
+// directory they were installed to, and writes the startup file snippet
+// that makes it do so.
+package rc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/TerenceU/the-autocompletor/internal/shell"
+)
+
+// checkTimeout limits the shell spawned by Check; startup files can be slow.
+const checkTimeout = 10 * time.Second
+
+// Markers delimit the snippet in startup files, so applying it again
+// replaces it instead of adding a copy.
+const (
+	beginMarker = "# >>> theautocompletor >>>"
+	endMarker   = "# <<< theautocompletor <<<"
+)
+
+// Lines printed by the check scripts; anything else the startup files
+// print is ignored.
+const (
+	tagLoaded = "__theautocompletor_loaded"
+	tagPath   = "__theautocompletor_path" // the directory is searched (fpath, fish_complete_path)
+	tagInit   = "__theautocompletor_init" // the completion system is initialised (compinit, bash-completion)
+)
+
+// Result is what a spawned shell reported about the completions of a program.
+type Result struct {
+	// Loaded reports whether the shell has completions for the program.
+	Loaded bool
+	// InPath reports whether the install directory is searched by the
+	// shell (zsh fpath, fish fish_complete_path). Always false for bash.
+	InPath bool
+	// Initialised reports whether compinit (zsh) or bash-completion (bash)
+	// was loaded by the startup files. Always true for fish.
+	Initialised bool
+}
+
+// Check starts sh the way a new terminal would read its startup files, and
+// asks it whether completions for program load from dir.
+func Check(ctx context.Context, sh shell.Shell, dir, program string) (Result, error) {
+	program = filepath.Base(program)
+	var args []string
+	switch sh {
+	case shell.Zsh:
+		args = []string{"-i", "-c", fmt.Sprintf(`
+(( ${fpath[(Ie)%[1]s]} )) && print %[3]s
+(( $+functions[compdef] )) && print %[4]s
+(( $+_comps[%[2]s] )) && print %[5]s
+`, quote(dir), quote(program), tagPath, tagInit, tagLoaded)}
+	case shell.Bash:
+		args = []string{"-i", "-c", fmt.Sprintf(`
+if declare -F _comp_load >/dev/null; then
+    echo %[2]s; _comp_load -- %[1]s >/dev/null 2>&1
+elif declare -F __load_completion >/dev/null; then
+    echo %[2]s; __load_completion %[1]s >/dev/null 2>&1
+fi
+complete -p -- %[1]s >/dev/null 2>&1 && echo %[3]s
+`, quote(program), tagInit, tagLoaded)}
+	case shell.Fish:
+		args = []string{"-c", fmt.Sprintf(`
+contains -- %[1]s $fish_complete_path; and echo %[3]s
+complete -C %[2]s | string length -q; and echo %[4]s
+`, quote(dir), quote(program+" -"), tagPath, tagLoaded)}
+	default:
+		return Result{}, fmt.Errorf("cannot check shell %q", sh)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, string(sh), args...)
+	cmd.WaitDelay = time.Second
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil && stdout.Len() == 0 {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return Result{}, fmt.Errorf("%s did not start within %s", sh, checkTimeout)
+		}
+		if errors.Is(err, exec.ErrNotFound) {
+			return Result{}, fmt.Errorf("%s is not installed", sh)
+		}
+	}
+
+	res := Result{Initialised: sh == shell.Fish}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		switch strings.TrimSpace(line) {
+		case tagLoaded:
+			res.Loaded = true
+		case tagPath:
+			res.InPath = true
+		case tagInit:
+			res.Initialised = true
+		}
+	}
+	return res, nil
+}
+
+// Reasons explains why completions did not load for sh.
+func (r Result) Reasons(sh shell.Shell) []string {
+	var reasons []string
+	switch sh {
+	case shell.Zsh:
+		if !r.InPath {
+			reasons = append(reasons, "the directory is not in fpath")
+		}
+		if !r.Initialised {
+			reasons = append(reasons, "compinit is not run")
+		}
+	case shell.Bash:
+		if !r.Initialised {
+			reasons = append(reasons, "bash-completion is not loaded")
+		}
+	case shell.Fish:
+		if !r.InPath {
+			reasons = append(reasons, "the directory is not in fish_complete_path")
+		}
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "the script is not picked up")
+	}
+	return reasons
+}
+
+// File returns the startup file the snippet for sh goes to. Fish gets a
+// file of its own in conf.d.
+func File(sh shell.Shell) string {
+	home, _ := os.UserHomeDir()
+	switch sh {
+	case shell.Zsh:
+		dir := os.Getenv("ZDOTDIR")
+		if dir == "" {
+			dir = home
+		}
+		return filepath.Join(dir, ".zshrc")
+	case shell.Bash:
+		return filepath.Join(home, ".bashrc")
+	case shell.Fish:
+		config := os.Getenv("XDG_CONFIG_HOME")
+		if config == "" {
+			config = filepath.Join(home, ".config")
+		}
+		return filepath.Join(config, "fish", "conf.d", "theautocompletor.fish")
+	}
+	return ""
+}
+
+// bashCompletionScripts are the usual locations of bash-completion's main script.
+var bashCompletionScripts = []string{
+	"/usr/share/bash-completion/bash_completion",
+	"/usr/local/share/bash-completion/bash_completion",
+	"/etc/bash_completion",
+	"/opt/homebrew/etc/profile.d/bash_completion.sh",
+	"/usr/local/etc/profile.d/bash_completion.sh",
+}
+
+// ErrNothingToAdd is returned by Snippet when the startup file already does
+// all it can: bash-completion is loaded and looks up scripts in dir itself.
+var ErrNothingToAdd = errors.New("the startup file already loads completions from this directory")
+
+// Snippet returns the lines (without markers) that make sh load the
+// completions installed in dir, given what Check found, or ErrNothingToAdd.
+func Snippet(sh shell.Shell, dir string, res Result) (string, error) {
+	var b strings.Builder
+	switch sh {
+	case shell.Zsh:
+		fmt.Fprintf(&b, "fpath=(%s $fpath)\n", quote(dir))
+		if !res.Initialised {
+			b.WriteString("autoload -Uz compinit && compinit\n")
+		}
+	case shell.Bash:
+		// bash-completion loads its own directories on demand; any other
+		// directory is sourced as a whole.
+		lazyDir := dir == shell.CompletionsDir(sh) || dir == shell.SystemCompletionsDir(sh)
+		script := ""
+		for _, s := range bashCompletionScripts {
+			if _, err := os.Stat(s); err == nil {
+				script = s
+				break
+			}
+		}
+		if script != "" && !res.Initialised {
+			fmt.Fprintf(&b, "if ! declare -F _comp_load >/dev/null && ! declare -F __load_completion >/dev/null; then\n")
+			fmt.Fprintf(&b, "    [[ -r %[1]s ]] && . %[1]s\n", quote(script))
+			b.WriteString("fi\n")
+		}
+		if script == "" || !lazyDir {
+			fmt.Fprintf(&b, "for f in %s/*; do\n    [[ -r $f ]] && . \"$f\"\ndone\nunset f\n", quote(dir))
+		}
+	case shell.Fish:
+		fmt.Fprintf(&b, "if not contains -- %[1]s $fish_complete_path\n    set -p fish_complete_path %[1]s\nend\n", quote(dir))
+	}
+	if b.Len() == 0 {
+		return "", ErrNothingToAdd
+	}
+	return b.String(), nil
+}
+
+// Block wraps snippet in the markers.
+func Block(snippet string) string {
+	return beginMarker + "\n" + snippet + endMarker + "\n"
+}
+
+// compinitLine finds the first line of a .zshrc that runs compinit, directly
+// or through a framework; fpath must be extended before it.
+var compinitLine = regexp.MustCompile(`(?m)^[^#\n]*(compinit|oh-my-zsh\.sh|zinit|zplug|antidote|prezto)`)
+
+// Apply writes the snippet to the startup file of sh and returns its path.
+// A previous snippet is replaced; a new one goes before compinit in .zshrc
+// and at the end of other files.
+func Apply(sh shell.Shell, snippet string) (string, error) {
+	path := File(sh)
+	if path == "" {
+		return "", fmt.Errorf("no startup file for shell %q", sh)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	content := string(data)
+	block := Block(snippet)
+
+	begin := strings.Index(content, beginMarker)
+	end := strings.Index(content, endMarker)
+	switch {
+	case begin >= 0 && end > begin:
+		rest := content[end+len(endMarker):]
+		content = content[:begin] + block + strings.TrimPrefix(rest, "\n")
+	case sh == shell.Zsh && compinitLine.MatchString(content):
+		i := compinitLine.FindStringIndex(content)[0]
+		content = content[:i] + block + "\n" + content[i:]
+	default:
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if content != "" {
+			content += "\n"
+		}
+		content += block
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// quote single-quotes s for zsh, bash and fish.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
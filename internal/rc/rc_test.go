@@ -0,0 +1,44 @@
+package rc
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TerenceU/the-autocompletor/internal/shell"
+)
+
+func TestSnippetBash(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	script := filepath.Join(t.TempDir(), "bash_completion")
+	if err := os.WriteFile(script, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saved := bashCompletionScripts
+	bashCompletionScripts = []string{script}
+	t.Cleanup(func() { bashCompletionScripts = saved })
+	lazyDir := shell.CompletionsDir(shell.Bash)
+
+	// bash-completion loaded and reading the directory: nothing left to add
+	if snippet, err := Snippet(shell.Bash, lazyDir, Result{Initialised: true}); !errors.Is(err, ErrNothingToAdd) {
+		t.Errorf("Snippet = %q, %v; want ErrNothingToAdd", snippet, err)
+	}
+
+	snippet, err := Snippet(shell.Bash, lazyDir, Result{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(snippet, ". "+quote(script)) || strings.Contains(snippet, "for f in") {
+		t.Errorf("lazy directory without bash-completion loaded:\n%s", snippet)
+	}
+
+	snippet, err = Snippet(shell.Bash, "/opt/completions", Result{Initialised: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(snippet, "for f in '/opt/completions'/*; do") {
+		t.Errorf("other directory not sourced:\n%s", snippet)
+	}
+}
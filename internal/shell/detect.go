@@ -3,6 +3,7 @@ package shell
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 )
@@ -21,29 +22,54 @@ var supported = map[Shell]bool{
 	Zsh:  true,
 }
 
-// Detect returns the current shell, checking env variables in order.
-func Detect() (Shell, error) {
-	// Fish sets $FISH_VERSION, zsh sets $ZSH_VERSION, bash sets $BASH_VERSION
-	if os.Getenv("FISH_VERSION") != "" {
-		return Fish, nil
+// All lists the supported shells.
+var All = []Shell{Bash, Zsh, Fish}
+
+// Installed returns the supported shells found in PATH.
+func Installed() []Shell {
+	var shells []Shell
+	for _, sh := range All {
+		if _, err := exec.LookPath(string(sh)); err == nil {
+			shells = append(shells, sh)
+		}
 	}
-	if os.Getenv("ZSH_VERSION") != "" {
-		return Zsh, nil
+	return shells
+}
+
+// Detect returns the shell the program was started from: the closest
+// interactive shell among its parent processes where /proc allows it,
+// otherwise from env variables and finally the login shell.
+func Detect() (Shell, error) {
+	sh, _, err := DetectReason()
+	return sh, err
+}
+
+// DetectReason is Detect, also returning how the shell was found.
+func DetectReason() (Shell, string, error) {
+	if sh, reason, ok := parentShell(); ok {
+		return sh, reason, nil
 	}
-	if os.Getenv("BASH_VERSION") != "" {
-		return Bash, nil
+
+	// Fish sets $FISH_VERSION, zsh sets $ZSH_VERSION, bash sets $BASH_VERSION
+	for _, v := range []struct {
+		env string
+		sh  Shell
+	}{{"FISH_VERSION", Fish}, {"ZSH_VERSION", Zsh}, {"BASH_VERSION", Bash}} {
+		if os.Getenv(v.env) != "" {
+			return v.sh, "$" + v.env + " is set", nil
+		}
 	}
 
 	// Fallback: parse $SHELL
 	shellPath := os.Getenv("SHELL")
 	if shellPath == "" {
-		return "", fmt.Errorf("could not detect current shell: $SHELL is not set")
+		return "", "", fmt.Errorf("could not detect current shell: $SHELL is not set")
 	}
 	name := Shell(strings.ToLower(filepath.Base(shellPath)))
 	if !supported[name] {
-		return "", fmt.Errorf("shell %q is not supported (supported: fish, bash, zsh)", name)
+		return "", "", fmt.Errorf("shell %q is not supported (supported: fish, bash, zsh)", name)
 	}
-	return name, nil
+	return name, "$SHELL is " + shellPath + ", the login shell", nil
 }
 
 // Parse validates and returns a Shell from a user-provided string.
@@ -55,16 +81,41 @@ func Parse(s string) (Shell, error) {
 	return sh, nil
 }
 
-// CompletionsDir returns the default completions install directory for the shell.
+// CompletionsDir returns the per-user directory each shell loads completions
+// from on demand: bash-completion's and fish's directories under
+// $XDG_DATA_HOME (~/.local/share), and site-functions there for zsh, which
+// has to be added to fpath.
 func CompletionsDir(sh Shell) string {
-	home, _ := os.UserHomeDir()
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	switch sh {
+	case Fish:
+		return filepath.Join(data, "fish", "vendor_completions.d")
+	case Bash:
+		return filepath.Join(data, "bash-completion", "completions")
+	case Zsh:
+		return filepath.Join(data, "zsh", "site-functions")
+	default:
+		return ""
+	}
+}
+
+// SystemCompletionsDir returns the system-wide directory for locally
+// installed completions, loaded by every user's shell.
+func SystemCompletionsDir(sh Shell) string {
 	switch sh {
 	case Fish:
-		return filepath.Join(home, ".config", "fish", "completions")
+		return "/usr/local/share/fish/vendor_completions.d"
 	case Bash:
-		return filepath.Join(home, ".bash_completion.d")
+		return "/usr/local/share/bash-completion/completions"
 	case Zsh:
-		return filepath.Join(home, ".zsh", "completions")
+		return "/usr/local/share/zsh/site-functions"
 	default:
 		return ""
 	}
@@ -0,0 +1,105 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxAncestors bounds the walk up the process tree.
+const maxAncestors = 64
+
+// optionArgs are the options of each shell whose value is the next
+// argument. bash's -C (noclobber) takes none, fish's -C a command.
+var optionArgs = map[Shell][]string{
+	Bash: {"-o", "+o", "-O", "+O", "--rcfile", "--init-file"},
+	Zsh:  {"-o", "+o"},
+	Fish: {"-C", "--init-command", "-d", "--debug", "-o", "--debug-output", "--profile", "--profile-startup"},
+}
+
+// parentShell walks up from the parent process to the first interactive
+// fish, bash or zsh. Shells running scripts or -c commands are skipped, so
+// a wrapper script doesn't count as the user's shell.
+func parentShell() (Shell, string, bool) {
+	pid := os.Getppid()
+	for range maxAncestors {
+		if pid <= 1 {
+			break
+		}
+		comm, ppid, err := procStat(pid)
+		if err != nil {
+			break
+		}
+		// Login shells are named like "-bash"
+		sh := Shell(strings.TrimPrefix(comm, "-"))
+		if supported[sh] && interactive(sh, pid) {
+			return sh, fmt.Sprintf("started from %s, pid %d", sh, pid), true
+		}
+		pid = ppid
+	}
+	return "", "", false
+}
+
+// procStat returns the command name and parent pid of process pid.
+func procStat(pid int) (string, int, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return "", 0, err
+	}
+	// "pid (comm) state ppid ...", where comm may contain spaces and parentheses
+	stat := string(data)
+	start, end := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if start < 0 || end < start {
+		return "", 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 2 {
+		return "", 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return "", 0, err
+	}
+	return stat[start+1 : end], ppid, nil
+}
+
+// interactive reports whether the shell sh running as process pid reads
+// commands from the user.
+func interactive(sh Shell, pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return false
+	}
+	return interactiveArgs(sh, strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00"))
+}
+
+// interactiveArgs reports whether sh started with the command line args
+// (args[0] being its name) is interactive: it runs neither a script nor a
+// -c command, unless forced with -i.
+func interactiveArgs(sh Shell, args []string) bool {
+	forced, command := false, false
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return forced || !command && i+1 == len(args)
+		case arg == "--interactive":
+			forced = true
+		case arg == "--command":
+			command = true
+		case slices.Contains(optionArgs[sh], arg):
+			i++
+		case strings.HasPrefix(arg, "--"):
+		case len(arg) > 1 && (arg[0] == '-' || arg[0] == '+'):
+			forced = forced || strings.ContainsRune(arg[1:], 'i')
+			command = command || strings.ContainsRune(arg[1:], 'c')
+		default:
+			// A script file; the remaining arguments are its own
+			return forced
+		}
+	}
+	return forced || !command
+}
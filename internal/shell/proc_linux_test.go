@@ -0,0 +1,36 @@
+package shell
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInteractiveArgs(t *testing.T) {
+	tests := []struct {
+		cmdline string
+		want    bool
+	}{
+		{"bash", true},
+		{"-bash", true},
+		{"bash -c cmd", false},
+		{"bash -ic cmd", true},
+		{"bash script.sh", false},
+		{"bash -C script", false},
+		{"bash -o vi", true},
+		{"bash --rcfile rc", true},
+		{"bash -- script", false},
+		{"zsh -i", true},
+		{"zsh -o vi", true},
+		{"fish --init-command x", true},
+		{"fish -C x", true},
+		{"fish --command x", false},
+		{"fish script.fish", false},
+	}
+	for _, tt := range tests {
+		args := strings.Fields(tt.cmdline)
+		sh := Shell(strings.TrimPrefix(args[0], "-"))
+		if got := interactiveArgs(sh, args); got != tt.want {
+			t.Errorf("%q: interactive = %v, want %v", tt.cmdline, got, tt.want)
+		}
+	}
+}
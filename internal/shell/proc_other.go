@@ -0,0 +1,9 @@
+//go:build !linux
+
+package shell
+
+// parentShell is only implemented on Linux, where /proc describes the
+// process tree; elsewhere detection relies on the environment.
+func parentShell() (Shell, string, bool) {
+	return "", "", false
+}
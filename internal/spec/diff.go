@@ -0,0 +1,79 @@
+package spec
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+// Changes lists the flags and subcommands that differ between two specs,
+// each written as its path from the program, e.g. "remote add --tags".
+type Changes struct {
+	Added   []string
+	Removed []string
+}
+
+// Empty reports whether nothing changed.
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0
+}
+
+// Diff compares the old and new spec of a program. A nil old spec counts
+// as empty. The contents of added or removed subcommands are not listed.
+func Diff(old, new *model.Command) Changes {
+	var c Changes
+	diffCommand(&c, "", old, new)
+	return c
+}
+
+func diffCommand(c *Changes, prefix string, old, new *model.Command) {
+	if old == nil {
+		old = &model.Command{}
+	}
+	oldFlags, newFlags := flagKeys(old), flagKeys(new)
+	for _, k := range newFlags {
+		if !slices.Contains(oldFlags, k) {
+			c.Added = append(c.Added, prefix+k)
+		}
+	}
+	for _, k := range oldFlags {
+		if !slices.Contains(newFlags, k) {
+			c.Removed = append(c.Removed, prefix+k)
+		}
+	}
+
+	for _, sub := range new.Subcommands {
+		before := subcommand(old, sub.Name)
+		if before == nil {
+			c.Added = append(c.Added, prefix+sub.Name)
+			continue
+		}
+		diffCommand(c, prefix+sub.Name+" ", before, sub)
+	}
+	for _, sub := range old.Subcommands {
+		if subcommand(new, sub.Name) == nil {
+			c.Removed = append(c.Removed, prefix+sub.Name)
+		}
+	}
+}
+
+// flagKeys returns one spelling per flag, preferring the long one.
+func flagKeys(cmd *model.Command) []string {
+	var keys []string
+	for _, f := range cmd.Flags {
+		if k := cmp.Or(f.Long, f.Old, f.Short); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func subcommand(cmd *model.Command, name string) *model.Command {
+	for _, sub := range cmd.Subcommands {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Package spec stores parsed command trees so that completion scripts can
+// consult them at runtime (theautocompletor __complete).
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/TerenceU/the-autocompletor/internal/model"
+)
+
+// Dir returns the directory specs are stored in:
+// $XDG_DATA_HOME/theautocompletor/specs, falling back to ~/.local/share.
+func Dir() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "theautocompletor", "specs")
+}
+
+// Path returns the file the spec of program is stored in.
+func Path(program string) string {
+	return filepath.Join(Dir(), filepath.Base(program)+".json")
+}
+
+// Save stores cmd as the spec of the program it describes and returns the path.
+func Save(cmd *model.Command) (string, error) {
+	path := Path(cmd.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("could not create spec directory: %w", err)
+	}
+	data, err := json.MarshalIndent(cmd, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("could not write spec: %w", err)
+	}
+	return path, nil
+}
+
+// Load reads the stored spec of program.
+func Load(program string) (*model.Command, error) {
+	data, err := os.ReadFile(Path(program))
+	if err != nil {
+		return nil, err
+	}
+	var cmd model.Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return nil, fmt.Errorf("%s: %w", Path(program), err)
+	}
+	return &cmd, nil
+}
@@ -1,25 +1,77 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
-	"github.com/spf13/cobra"
 	"github.com/TerenceU/the-autocompletor/internal/ai"
+	"github.com/TerenceU/the-autocompletor/internal/batch"
+	"github.com/TerenceU/the-autocompletor/internal/complete"
+	"github.com/TerenceU/the-autocompletor/internal/doctor"
 	"github.com/TerenceU/the-autocompletor/internal/generator"
+	"github.com/TerenceU/the-autocompletor/internal/hooks"
 	"github.com/TerenceU/the-autocompletor/internal/installer"
+	"github.com/TerenceU/the-autocompletor/internal/lazy"
 	"github.com/TerenceU/the-autocompletor/internal/model"
+	"github.com/TerenceU/the-autocompletor/internal/overrides"
 	"github.com/TerenceU/the-autocompletor/internal/parser"
+	"github.com/TerenceU/the-autocompletor/internal/rc"
 	"github.com/TerenceU/the-autocompletor/internal/shell"
+	"github.com/TerenceU/the-autocompletor/internal/spec"
+	"github.com/spf13/cobra"
 )
 
+// version is set at build time with -ldflags "-X main.version=v1.2.3";
+// otherwise the module version from the build info is used.
+var version = "dev"
+
 var (
-	flagShell  string
-	flagInstall bool
-	flagAI     string
-	flagAPIKey string
-	flagModel  string
+	flagShell          string
+	flagInstall        bool
+	flagAI             string
+	flagAPIKey         string
+	flagModel          string
+	flagHelpStrategies []string
+	flagKeepLocale     bool
+	flagNoNative       bool
+	flagHelpFile       string
+	flagManFile        string
+	flagExplain        bool
+	flagConcurrency    int
+	flagTimeout        time.Duration
+	flagProbeTimeout   time.Duration
+	flagRefreshAll     bool
+	flagStdin          bool
+	flagWatch          []string
+	flagPrint          bool
+	flagFromFile       string
+	flagAllInPath      bool
+	flagInclude        []string
+	flagExclude        []string
+	flagSkipExisting   bool
+	flagJobs           int
+	flagSystem         bool
+	flagDir            string
+	flagSetupRC        bool
+	flagNoVerify       bool
+	flagOverwrite      bool
+	flagDryRun         bool
 )
 
 var rootCmd = &cobra.Command{
@@ -31,52 +83,987 @@ man page, --help output, and subcommands recursively.
 If the program cannot be analyzed, an AI fallback (Ollama or OpenAI) can be used.
 
 If you want autocompletions for this program try:
-  theautocompletor theautocompletor --install 
+  theautocompletor install theautocompletor
 
 Examples:
   theautocompletor gobuster
-  theautocompletor gobuster --install
-  theautocompletor gobuster --shell fish --install
+  theautocompletor install gobuster
+  theautocompletor install gobuster --shell fish
   theautocompletor gobuster --ai ollama
-  theautocompletor gobuster --ai openai --api-key sk-...`,
-	Args:              cobra.ExactArgs(1),
-	RunE:              run,
-	SilenceErrors:     true,
+  theautocompletor gobuster --ai openai --api-key sk-...
+  theautocompletor list
+
+"theautocompletor <program>" is short for "theautocompletor generate <program>";
+use the latter for programs named like one of the commands below.`,
+	Args:          cobra.ArbitraryArgs,
+	RunE:          run,
+	SilenceErrors: true,
+}
+
+var generateCmd = &cobra.Command{
+	Use:   "generate <program>...",
+	Short: "Print completions for a program",
+	Args:  cobra.ArbitraryArgs,
+	RunE:  run,
+}
+
+var installCmd = &cobra.Command{
+	Use:   "install <program>...",
+	Short: "Generate completions and install them to the shell's completions directory",
+	Args:  cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flagInstall = true
+		return run(cmd, args)
+	},
+}
+
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall <program>...",
+	Short: "Remove installed completions (for every shell unless --shell is given)",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runUninstall,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List installed completions and whether they are outdated",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := installer.LoadManifest()
+		if err != nil {
+			return err
+		}
+		if len(m.Entries) == 0 {
+			fmt.Fprintln(os.Stderr, "No completions installed.")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PROGRAM\tSHELL\tSTATUS\tPATH")
+		for _, e := range m.Entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Program, e.Shell, e.Check(), e.Path)
+		}
+		return w.Flush()
+	},
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status [program]",
+	Short: "Show details of installed completions",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runStatus,
+}
+
+var refreshCmd = &cobra.Command{
+	Use:   "refresh [program]...",
+	Short: "Regenerate installed completions whose program changed",
+	Long: `Re-parse every program whose binary changed since its completions were
+installed, reinstall them for each shell they were installed for, and print
+the flags and subcommands that were added or removed. Scripts that were
+deleted are reinstalled, and completions of programs that are no longer
+installed are removed. Completions made with --ai or --help-file are listed
+as not refreshable: install them again to update them.
+
+With arguments, only those programs are considered.`,
+	RunE: runRefresh,
+}
+
+var hooksCmd = &cobra.Command{
+	Use:   "hooks",
+	Short: "Manage hooks that refresh completions when programs change",
+}
+
+var hooksInstallCmd = &cobra.Command{
+	Use:   "install [pacman|apt|systemd]...",
+	Short: "Install package manager hooks and a systemd path unit that run refresh",
+	Long: `Install hooks that run "theautocompletor refresh" after programs change:
+
+  pacman   /etc/pacman.d/hooks/theautocompletor.hook (needs sudo)
+  apt      DPkg::Post-Invoke in /etc/apt/apt.conf.d/80theautocompletor (needs sudo)
+  systemd  a user path unit watching bin directories (run without sudo)
+
+Without arguments, every mechanism found on the system is installed. The
+pacman and apt hooks run as root and refresh the completions of the user who
+ran sudo.`,
+	ValidArgs: []string{"pacman", "apt", "systemd"},
+	RunE:      runHooksInstall,
+}
+
+var hooksUninstallCmd = &cobra.Command{
+	Use:       "uninstall [pacman|apt|systemd]...",
+	Short:     "Remove the hooks (all of them without arguments)",
+	ValidArgs: []string{"pacman", "apt", "systemd"},
+	RunE:      runHooksUninstall,
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [program]",
+	Short: "Check the shells, tools, AI backends and completion setup",
+	Long: `Check what theautocompletor depends on and print what to do about each
+problem: installed shells and the one detected, man and col, whether new
+shell sessions load completions from the install directory (fpath, compinit,
+bash-completion), the AI backends, and the stored manifest and specs.
+
+With a program, also list every completion script found for it, to spot
+ones shadowing each other.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runDoctor,
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init <shell>",
+	Short: "Print a shell hook that generates completions on the first TAB",
+	Long: `Print init code for bash, zsh or fish. When TAB is pressed for a command
+that has no completions, the hook generates and installs them in the
+background, then loads them on a following TAB.
+
+  bash:  eval "$(theautocompletor init bash)"        (in ~/.bashrc)
+  zsh:   eval "$(theautocompletor init zsh)"         (in ~/.zshrc, after compinit)
+  fish:  theautocompletor init fish | source         (in config.fish)`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sh, err := shell.Parse(args[0])
+		if err != nil {
+			return err
+		}
+		snippet, err := lazy.Snippet(sh, shell.CompletionsDir(sh))
+		if err != nil {
+			return err
+		}
+		fmt.Print(snippet)
+		return nil
+	},
+}
+
+// lazyCmd is started in the background by the init hooks.
+var lazyCmd = &cobra.Command{
+	Use:    "__lazy <shell> <program>",
+	Hidden: true,
+	Args:   cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		// The hooks pass the command word as typed; only a plain name off
+		// the denylist is generated in the background.
+		program := args[1]
+		if filepath.Base(program) != program || program == "." || program == ".." {
+			return fmt.Errorf("%q is not a program name", program)
+		}
+		excludes, err := batch.Excludes()
+		if err != nil {
+			return err
+		}
+		if batch.Excluded(program, excludes) {
+			return nil
+		}
+		release, err := lazy.Lock(program)
+		if errors.Is(err, lazy.ErrRunning) {
+			return nil // another TAB already started it
+		}
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		sh, err := shell.Parse(args[0])
+		if err != nil {
+			return err
+		}
+		// Nobody asked for this program to be run: only its help flags are
+		// tried, unless configured otherwise, and no shell is started.
+		err = generateAndInstall(cmd.Context(), program, installOptions{
+			shells:        []shell.Shell{sh},
+			helpFlagsOnly: true,
+		})
+		if err != nil {
+			lazy.MarkFailed(program)
+			return err
+		}
+		return nil
+	},
 }
 
 func init() {
-	rootCmd.Flags().StringVar(&flagShell, "shell", "", "Target shell: fish, bash, zsh (auto-detected if not set)")
-	rootCmd.Flags().BoolVar(&flagInstall, "install", false, "Install completions to the shell's completions directory")
-	rootCmd.Flags().StringVar(&flagAI, "ai", "", "AI fallback to use: ollama, openai")
-	rootCmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key for OpenAI (or set OPENAI_API_KEY env var)")
-	rootCmd.Flags().StringVar(&flagModel, "model", "", "AI model to use (default: llama3 for ollama, gpt-4o-mini for openai)")
+	rootCmd.AddCommand(generateCmd, installCmd, uninstallCmd, listCmd, statusCmd, refreshCmd, hooksCmd, doctorCmd, initCmd, lazyCmd)
+	hooksCmd.AddCommand(hooksInstallCmd, hooksUninstallCmd)
+	// Only our own subcommands: "completion" could be a program name.
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.Version = buildVersion()
+
+	for _, c := range []*cobra.Command{rootCmd, generateCmd, installCmd} {
+		addGenerateFlags(c)
+		addBatchFlags(c)
+	}
+	rootCmd.Flags().BoolVar(&flagInstall, "install", false, "Install completions to the shell's completions directory (same as the install command)")
+	for _, c := range []*cobra.Command{rootCmd, installCmd} {
+		c.Flags().BoolVar(&flagSystem, "system", false, "Install for all users under /usr/local/share (needs root)")
+		c.Flags().StringVar(&flagDir, "dir", "", "Install into this directory instead of the shell's completions directory")
+		c.MarkFlagsMutuallyExclusive("system", "dir")
+		c.Flags().BoolVar(&flagSetupRC, "setup-rc", false, "Add what the shell needs to load the completions to its startup file")
+		c.Flags().BoolVar(&flagNoVerify, "no-verify", false, "Don't start the shell to check that the completions load")
+		c.Flags().BoolVar(&flagOverwrite, "force", false, "Replace completion files not generated by theautocompletor (a backup is kept)")
+		c.Flags().BoolVar(&flagDryRun, "dry-run", false, "Show where completions would be installed and a diff against the existing file")
+	}
+	uninstallCmd.Flags().StringVar(&flagShell, "shell", "", "Only remove the completions for this shell")
+	addProbeFlags(refreshCmd)
+	refreshCmd.Flags().BoolVar(&flagRefreshAll, "all", false, "Regenerate even if the program did not change")
+	refreshCmd.Flags().BoolVar(&flagStdin, "stdin", false, "Only consider the programs whose paths are read from stdin, one per line (package manager hooks)")
+	hooksInstallCmd.Flags().StringSliceVar(&flagWatch, "watch", nil, "Directories the systemd unit watches (default: /usr/bin, /usr/local/bin, ~/.local/bin)")
+	hooksInstallCmd.Flags().BoolVar(&flagPrint, "print", false, "Print the hook files instead of installing them")
+	doctorCmd.Flags().StringVar(&flagAI, "ai", "", "AI backend you use: its problems are errors (ollama, openai)")
+	doctorCmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key for OpenAI (or set OPENAI_API_KEY env var)")
+	doctorCmd.Flags().StringVar(&flagModel, "model", "", "AI model to check for")
+}
+
+// addGenerateFlags registers the flags controlling parsing and generation on c.
+func addGenerateFlags(c *cobra.Command) {
+	c.Flags().StringVar(&flagShell, "shell", "", "Target shell: fish, bash, zsh, or all for every installed shell (auto-detected if not set)")
+	addProbeFlags(c)
+	c.Flags().StringVar(&flagAI, "ai", "", "AI fallback to use: ollama, openai")
+	c.Flags().StringVar(&flagAPIKey, "api-key", "", "API key for OpenAI (or set OPENAI_API_KEY env var)")
+	c.Flags().StringVar(&flagModel, "model", "", "AI model to use (default: llama3 for ollama, gpt-4o-mini for openai)")
+	c.Flags().StringVar(&flagHelpFile, "help-file", "", "Read help output from a file, - (stdin) or a directory of <sub>/help.txt files instead of running the program")
+	c.Flags().StringVar(&flagManFile, "man-file", "", "Read the man page from a file (roff or rendered, may be gzipped) or - instead of running man")
+	c.Flags().BoolVar(&flagExplain, "explain", false, "Print a report of parsed and rejected lines (source, confidence) to stderr")
+	c.Flags().BoolVar(&flagExplain, "diagnose", false, "Alias for --explain")
+	c.Flags().MarkHidden("diagnose")
+	c.Flags().StringSliceVar(&flagHelpStrategies, "help-strategy", nil, "Ordered help strategies to try: --help, -h, help, -help (default: all, in that order)")
+}
+
+// addBatchFlags registers the flags selecting several programs at once on c.
+func addBatchFlags(c *cobra.Command) {
+	c.Flags().StringVar(&flagFromFile, "from-file", "", "Also read program names from a file (- for stdin), one per line")
+	c.Flags().BoolVar(&flagAllInPath, "all-in-path", false, "Generate completions for every executable in PATH")
+	c.Flags().StringSliceVar(&flagInclude, "include", nil, "Only programs matching one of these globs, e.g. 'git*' (batch mode)")
+	c.Flags().StringSliceVar(&flagExclude, "exclude", nil, "Skip programs matching one of these globs (batch mode)")
+	c.Flags().BoolVar(&flagSkipExisting, "skip-existing", false, "Skip programs that already have completions for the shell (batch mode)")
+	c.Flags().IntVar(&flagJobs, "jobs", 4, "Number of programs parsed at once (batch mode)")
+}
+
+// addProbeFlags registers the flags controlling how programs are probed on c.
+func addProbeFlags(c *cobra.Command) {
+	c.Flags().BoolVar(&flagKeepLocale, "keep-locale", false, "Probe programs in your locale instead of LC_ALL=C (translated descriptions)")
+	c.Flags().BoolVar(&flagNoNative, "no-native", false, "Ignore fish/zsh completion scripts already installed for the program")
+	c.Flags().IntVar(&flagConcurrency, "concurrency", parser.DefaultConcurrency, "Maximum number of help probes running at once")
+	c.Flags().DurationVar(&flagTimeout, "timeout", 0, "Overall deadline for parsing, e.g. 2m (0 = none)")
+	c.Flags().DurationVar(&flagProbeTimeout, "probe-timeout", parser.DefaultProbeTimeout, "Time limit for each help/man probe")
 }
 
 func run(cmd *cobra.Command, args []string) error {
+	shells, err := targetShells()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 && flagFromFile == "" && !flagAllInPath {
+		return fmt.Errorf("requires a program (or --from-file, --all-in-path)")
+	}
+	cmd.SilenceUsage = true // errors from here on are not about usage
+	if len(args) != 1 || flagFromFile != "" || flagAllInPath {
+		return runBatch(cmd, shells, args)
+	}
 	program := args[0]
 
-	// Resolve target shell
-	var sh shell.Shell
-	var err error
-	if flagShell != "" {
-		sh, err = shell.Parse(flagShell)
-	} else {
-		sh, err = shell.Detect()
+	fmt.Fprintf(os.Stderr, "→ Generating %s completions for %q\n", shellNames(shells), program)
+	if flagInstall && !flagDryRun {
+		return generateAndInstall(cmd.Context(), program, installOptions{shells: shells, verify: !flagNoVerify})
+	}
+
+	// One parse serves every shell; sh only matters to the AI prompt
+	cmdTree, err := buildTree(cmd.Context(), program, shells[0], nil, stderrProgress, false)
+	if err != nil {
+		return err
+	}
+
+	if flagDryRun {
+		for _, sh := range shells {
+			change, err := planInstall(sh, program, render(sh, cmdTree))
+			if err != nil {
+				return err
+			}
+			printChange(*change)
+		}
+		return nil
+	}
+
+	if len(shells) == 1 {
+		fmt.Print(render(shells[0], cmdTree))
+		return nil
+	}
+	// --shell all: one script after the other, each under a comment line
+	for i, sh := range shells {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("# ==> %s <==\n", sh)
+		fmt.Print(render(sh, cmdTree))
+	}
+	return nil
+}
+
+// installOptions says how generateAndInstall treats a program.
+type installOptions struct {
+	shells        []shell.Shell // at least one
+	helpFlagsOnly bool          // probe with batch.HelpStrategies unless configured
+	verify        bool          // start each shell to check that it loads the script
+}
+
+// generateAndInstall parses program once and installs its completions for
+// every shell of opts, along with the spec used for runtime completion.
+func generateAndInstall(ctx context.Context, program string, opts installOptions) error {
+	// One parse serves every shell; sh only matters to the AI prompt
+	cmdTree, err := buildTree(ctx, program, opts.shells[0], nil, stderrProgress, opts.helpFlagsOnly)
+	if err != nil {
+		return err
+	}
+	saveSpec(cmdTree)
+	var errs []error
+	for _, sh := range opts.shells {
+		if err := install(ctx, sh, program, render(sh, cmdTree), origin(cmdTree), opts.verify); err != nil {
+			if len(opts.shells) > 1 {
+				err = fmt.Errorf("%s: %w", sh, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// install writes the completions of program for sh and records them with
+// their origin. With verify, it checks that new sessions of sh load them.
+func install(ctx context.Context, sh shell.Shell, program, output, origin string, verify bool) error {
+	path, backup, err := installer.Install(sh, installDir(sh), program, output, flagOverwrite)
+	if errors.Is(err, fs.ErrPermission) && flagSystem {
+		return fmt.Errorf("install failed: %w (--system needs sudo)", err)
+	}
+	if err != nil {
+		return fmt.Errorf("install failed: %w", err)
+	}
+	if backup != "" {
+		fmt.Fprintf(os.Stderr, "✓ Backed up the previous file to %s\n", backup)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Completions installed to %s\n", path)
+	if err := installer.Record(sh, program, path, buildVersion(), origin); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	lazy.ClearFailed(program)
+	if verify {
+		verifyInstall(ctx, sh, path, program)
+	}
+	return nil
+}
+
+// targetShells resolves --shell: the shell named, every installed one for
+// "all", or the detected one.
+func targetShells() ([]shell.Shell, error) {
+	switch flagShell {
+	case "":
+		sh, err := shell.Detect()
+		if err != nil {
+			return nil, err
+		}
+		return []shell.Shell{sh}, nil
+	case "all":
+		shells := shell.Installed()
+		if len(shells) == 0 {
+			return nil, fmt.Errorf("--shell all: none of fish, bash, zsh is installed")
+		}
+		return shells, nil
+	default:
+		sh, err := shell.Parse(flagShell)
+		if err != nil {
+			return nil, err
+		}
+		return []shell.Shell{sh}, nil
+	}
+}
+
+// shellNames lists shells for messages, e.g. "bash, zsh".
+func shellNames(shells []shell.Shell) string {
+	names := make([]string, len(shells))
+	for i, sh := range shells {
+		names[i] = string(sh)
+	}
+	return strings.Join(names, ", ")
+}
+
+// runRefresh regenerates the installed completions of the programs whose
+// binary changed, and removes those of programs that are gone.
+func runRefresh(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	m, err := installer.LoadManifest()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	var programs []string
+	for _, a := range args {
+		program := filepath.Base(a)
+		if len(m.Find(program)) == 0 {
+			errs = append(errs, fmt.Errorf("no installed completions for %q", program))
+			continue
+		}
+		programs = append(programs, program)
+	}
+	if flagStdin {
+		// Paths of changed files; the ones without completions are skipped
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if program := filepath.Base(line); len(m.Find(program)) > 0 && !slices.Contains(programs, program) {
+				programs = append(programs, program)
+			}
+		}
+	} else if len(args) == 0 {
+		for _, e := range m.Entries {
+			if !slices.Contains(programs, e.Program) {
+				programs = append(programs, e.Program)
+			}
+		}
+	}
+
+	// m is only read while programs are parsed, which takes a while: the
+	// changes are applied at the end under the manifest lock, so entries
+	// recorded meanwhile (lazy generations, batch installs) are kept.
+	var updates []func(m *installer.Manifest)
+	var refreshed, removed, current int
+	var fixed []string // not refreshable
+	for _, program := range programs {
+		entries := m.Find(program)
+		var shells []string
+		changed, gone, refreshable := flagRefreshAll, false, true
+		for _, e := range entries {
+			shells = append(shells, string(e.Shell))
+			switch e.Check() {
+			case installer.StatusOutdated, installer.StatusMissing:
+				changed = true
+			case installer.StatusOrphaned:
+				gone = true
+			}
+			refreshable = refreshable && e.Refreshable()
+		}
+		label := fmt.Sprintf("%s (%s)", program, strings.Join(shells, ", "))
+
+		if gone {
+			for _, e := range entries {
+				if err := installer.Uninstall(e); err != nil {
+					errs = append(errs, err)
+				}
+				updates = append(updates, func(m *installer.Manifest) { m.Remove(e.Program, e.Shell) })
+			}
+			os.Remove(spec.Path(program))
+			fmt.Fprintf(os.Stderr, "✗ %s: program no longer installed, completions removed\n", label)
+			removed++
+			continue
+		}
+		if !refreshable {
+			fixed = append(fixed, program)
+			continue
+		}
+		if !changed {
+			current++
+			continue
+		}
+
+		// The manifest stores base names; use the recorded binary if the
+		// program is not in PATH.
+		target := program
+		if _, err := exec.LookPath(program); err != nil && entries[0].Binary != "" {
+			target = entries[0].Binary
+		}
+		fmt.Fprintf(os.Stderr, "→ Refreshing %s\n", label)
+		previous, _ := spec.Load(program)
+		cmdTree, err := buildTree(cmd.Context(), target, entries[0].Shell, nil, stderrProgress, false)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", program, err))
+			continue
+		}
+		cmdTree.Name = program
+		saveSpec(cmdTree)
+		for _, e := range entries {
+			if _, err := installer.InstallTo(e.Path, render(e.Shell, cmdTree), false); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", program, err))
+				continue
+			}
+			updates = append(updates, func(m *installer.Manifest) {
+				m.Record(e.Shell, target, e.Path, buildVersion(), "")
+			})
+		}
+		refreshed++
+		printChanges(label, previous, cmdTree)
+	}
+
+	if len(updates) > 0 {
+		err := installer.UpdateManifest(func(m *installer.Manifest) {
+			for _, update := range updates {
+				update(m)
+			}
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Refreshed %d, removed %d, %d up to date", refreshed, removed, current)
+	if len(fixed) > 0 {
+		fmt.Fprintf(os.Stderr, ", %d not refreshable (%s): made with --ai or --help-file, install them again to update", len(fixed), strings.Join(fixed, ", "))
+	}
+	fmt.Fprintln(os.Stderr, ".")
+	return errors.Join(errs...)
+}
+
+// runHooksInstall writes the hooks named in args, or every one available.
+func runHooksInstall(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	kinds, err := hookKinds(args)
+	if err != nil {
+		return err
+	}
+	if len(kinds) == 0 {
+		return fmt.Errorf("no supported hook mechanism found (pacman, apt, systemd)")
+	}
+
+	binary, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(binary); err == nil {
+		binary = resolved
+	}
+	owner, err := user.Current()
+	if err != nil {
+		return err
+	}
+	root := os.Geteuid() == 0
+	if sudoUser := os.Getenv("SUDO_USER"); root && sudoUser != "" {
+		if owner, err = user.Lookup(sudoUser); err != nil {
+			return err
+		}
+	}
+	watch := flagWatch
+	if len(watch) == 0 {
+		watch = hooks.DefaultWatch()
+	}
+	opts := hooks.Options{Binary: binary, User: owner, Watch: watch}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, k := range kinds {
+		if k == hooks.Systemd && root && !flagPrint {
+			errs = append(errs, fmt.Errorf("systemd: the path unit belongs to your user, install it without sudo"))
+			continue
+		}
+		files := hooks.Files(k, opts)
+		if flagPrint {
+			for _, f := range files {
+				fmt.Printf("# %s\n%s\n", f.Path, f.Content)
+			}
+			continue
+		}
+		if err := writeHook(k, files); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeHook writes the files of a hook and enables the systemd unit.
+func writeHook(k hooks.Kind, files []hooks.File) error {
+	for _, f := range files {
+		if err := hooks.Write(f); err != nil {
+			if errors.Is(err, fs.ErrPermission) {
+				return fmt.Errorf("%s: %w (run with sudo)", k, err)
+			}
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		fmt.Fprintf(os.Stderr, "✓ Wrote %s\n", f.Path)
 	}
+	if k != hooks.Systemd {
+		return nil
+	}
+	for _, args := range [][]string{
+		{"--user", "daemon-reload"},
+		{"--user", "enable", "--now", hooks.SystemdPathUnit},
+	} {
+		if out, err := exec.Command("systemctl", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("systemd: systemctl %s: %v: %s", strings.Join(args, " "), err, bytes.TrimSpace(out))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "✓ Enabled %s\n", hooks.SystemdPathUnit)
+	return nil
+}
+
+// runHooksUninstall removes the hooks named in args, or all of them.
+func runHooksUninstall(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	kinds, err := hookKinds(args)
 	if err != nil {
 		return err
 	}
+	if len(args) == 0 {
+		kinds = hooks.Kinds
+	}
+	var errs []error
+	for _, k := range kinds {
+		for _, f := range hooks.Files(k, hooks.Options{}) {
+			if _, err := os.Stat(f.Path); err != nil {
+				continue
+			}
+			if k == hooks.Systemd && filepath.Base(f.Path) == hooks.SystemdPathUnit {
+				exec.Command("systemctl", "--user", "disable", "--now", hooks.SystemdPathUnit).Run()
+			}
+			if err := hooks.Remove(f); err != nil {
+				if errors.Is(err, fs.ErrPermission) {
+					err = fmt.Errorf("%w (run with sudo)", err)
+				}
+				errs = append(errs, err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "✓ Removed %s\n", f.Path)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hookKinds parses the hook mechanisms given as arguments, defaulting to
+// the ones found on the system.
+func hookKinds(args []string) ([]hooks.Kind, error) {
+	if len(args) == 0 {
+		return hooks.Detect(), nil
+	}
+	var kinds []hooks.Kind
+	for _, a := range args {
+		k, err := hooks.ParseKind(a)
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, k)
+	}
+	return kinds, nil
+}
+
+// printChanges reports the flags and subcommands added and removed since
+// the previous spec of a program.
+func printChanges(label string, previous, current *model.Command) {
+	if previous == nil {
+		fmt.Fprintf(os.Stderr, "✓ %s: regenerated (no previous spec to compare)\n", label)
+		return
+	}
+	changes := spec.Diff(previous, current)
+	if changes.Empty() {
+		fmt.Fprintf(os.Stderr, "✓ %s: no changes\n", label)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "✓ %s: %d added, %d removed\n", label, len(changes.Added), len(changes.Removed))
+	for _, c := range changes.Added {
+		fmt.Fprintf(os.Stderr, "    + %s\n", c)
+	}
+	for _, c := range changes.Removed {
+		fmt.Fprintf(os.Stderr, "    - %s\n", c)
+	}
+}
 
-	fmt.Fprintf(os.Stderr, "→ Generating %s completions for %q\n", sh, program)
+// batchJob is a program to generate completions for in batch mode, and the
+// shells to install them for.
+type batchJob struct {
+	program string
+	shells  []shell.Shell
+}
+
+// batchResult is the outcome of one program in batch mode.
+type batchResult struct {
+	program  string
+	installs []batchInstall
+	changes  []*installer.Change // with --dry-run
+	err      error
+}
+
+// batchInstall is a script installed in batch mode.
+type batchInstall struct {
+	program string
+	sh      shell.Shell
+	path    string // installed script
+	origin  string // see installer.Entry.Origin
+	backup  string // copy of the file it replaced
+}
+
+// runBatch installs completions for every program given as arguments, in
+// --from-file and with --all-in-path, parsing --jobs programs at once with
+// probes bounded by one shared pool.
+func runBatch(cmd *cobra.Command, shells []shell.Shell, args []string) error {
+	cmd.SilenceUsage = true
+	if !flagInstall && !flagDryRun {
+		return fmt.Errorf("several programs can only be installed: use \"theautocompletor install\" (or --install)")
+	}
+
+	// Listed programs are not chosen one by one: leave out the denylist
+	var listed []string
+	if flagFromFile != "" {
+		fromFile, err := batch.FromFile(flagFromFile, os.Stdin)
+		if err != nil {
+			return err
+		}
+		listed = append(listed, fromFile...)
+	}
+	if flagAllInPath {
+		listed = append(listed, batch.InPath()...)
+	}
+	excludes, err := batch.Excludes()
+	if err != nil {
+		return err
+	}
+	var denied int
+	listed = slices.DeleteFunc(listed, func(p string) bool {
+		if batch.Excluded(p, excludes) {
+			denied++
+			return true
+		}
+		return false
+	})
+	programs, err := batch.Filter(append(slices.Clone(args), listed...), flagInclude, flagExclude)
+	if err != nil {
+		return err
+	}
+	var todo []batchJob
+	var skipped []string
+	for _, p := range programs {
+		job := batchJob{program: p, shells: shells}
+		if flagSkipExisting {
+			job.shells = slices.DeleteFunc(slices.Clone(shells), func(sh shell.Shell) bool {
+				return installer.Existing(sh, p) != ""
+			})
+		}
+		if len(job.shells) == 0 {
+			skipped = append(skipped, p)
+			continue
+		}
+		todo = append(todo, job)
+	}
+	if len(todo) == 0 {
+		fmt.Fprintf(os.Stderr, "No programs to generate completions for (%d skipped).\n", len(skipped))
+		return nil
+	}
+	if denied > 0 {
+		fmt.Fprintf(os.Stderr, "→ Leaving out %d programs on the denylist (see %s)\n", denied, batch.ExcludesPath())
+	}
+	fmt.Fprintf(os.Stderr, "→ Generating %s completions for %d programs\n", shellNames(shells), len(todo))
+
+	ctx := cmd.Context()
+	pool := parser.NewPool(flagConcurrency)
+	jobs := make(chan batchJob)
+	results := make(chan batchResult)
+	var wg sync.WaitGroup
+	for range max(flagJobs, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results <- runBatchJob(ctx, job, pool)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, job := range todo {
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var failed []batchResult
+	var installs []batchInstall
+	// The first script installed for each shell is checked to load
+	var verify []batchInstall
+	verified := map[shell.Shell]bool{}
+	done := 0
+	for res := range results {
+		done++
+		if res.err != nil {
+			failed = append(failed, res)
+			fmt.Fprintf(os.Stderr, "  [%d/%d] ✗ %s\n", done, len(todo), res.program)
+		} else {
+			fmt.Fprintf(os.Stderr, "  [%d/%d] ✓ %s\n", done, len(todo), res.program)
+		}
+		for _, c := range res.changes {
+			printChange(*c)
+		}
+		for _, in := range res.installs {
+			if in.backup != "" {
+				fmt.Fprintf(os.Stderr, "    backed up the previous file to %s\n", in.backup)
+			}
+			installs = append(installs, in)
+			if !verified[in.sh] {
+				verified[in.sh] = true
+				verify = append(verify, in)
+			}
+		}
+		if len(res.installs) > 0 {
+			lazy.ClearFailed(res.program)
+		}
+	}
+	if !flagDryRun {
+		err := installer.UpdateManifest(func(m *installer.Manifest) {
+			for _, in := range installs {
+				m.Record(in.sh, in.program, in.path, buildVersion(), in.origin)
+			}
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+
+	verb := "Installed"
+	if flagDryRun {
+		verb = "Would install"
+	}
+	fmt.Fprintf(os.Stderr, "\n%s %d, failed %d, skipped %d", verb, done-len(failed), len(failed), len(skipped))
+	if notRun := len(todo) - done; notRun > 0 {
+		fmt.Fprintf(os.Stderr, ", not run %d", notRun)
+	}
+	fmt.Fprintln(os.Stderr, ".")
+	if len(failed) > 0 {
+		fmt.Fprintln(os.Stderr, "Failed:")
+		for _, res := range failed {
+			// Only the first line: the rest is a tip repeated for every program
+			reason, _, _ := strings.Cut(res.err.Error(), "\n")
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", res.program, reason)
+		}
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted")
+	}
+	if !flagNoVerify {
+		for _, v := range verify {
+			verifyInstall(ctx, v.sh, v.path, v.program)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d programs failed", len(failed), len(todo))
+	}
+	return nil
+}
+
+// runBatchJob parses one program of a batch and installs its completions
+// for each shell of the job, or plans them with --dry-run.
+func runBatchJob(ctx context.Context, job batchJob, pool parser.Pool) batchResult {
+	res := batchResult{program: job.program}
+	cmdTree, err := buildTree(ctx, job.program, job.shells[0], pool, nil, true)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	if !flagDryRun {
+		saveSpec(cmdTree)
+	}
+	var errs []error
+	for _, sh := range job.shells {
+		output := render(sh, cmdTree)
+		if flagDryRun {
+			change, err := planInstall(sh, job.program, output)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			res.changes = append(res.changes, change)
+			continue
+		}
+		path, backup, err := installer.Install(sh, installDir(sh), job.program, output, flagOverwrite)
+		if err != nil {
+			if len(job.shells) > 1 {
+				err = fmt.Errorf("%s: %w", sh, err)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		res.installs = append(res.installs, batchInstall{program: job.program, sh: sh, path: path, backup: backup, origin: origin(cmdTree)})
+	}
+	res.err = errors.Join(errs...)
+	return res
+}
+
+// buildTree parses program (falling back to AI when enabled) and applies its
+// overrides. sh is only used to prompt the AI. Probes take slots from pool,
+// or from a pool of their own if it is nil; progress may be nil. With
+// helpFlagsOnly, programs nobody configured are only probed with
+// batch.HelpStrategies.
+func buildTree(ctx context.Context, program string, sh shell.Shell, pool parser.Pool, progress parser.ProgressFunc, helpFlagsOnly bool) (*model.Command, error) {
+	// Per-program quirks: shipped defaults plus the user's overrides file
+	set, err := overrides.Load()
+	if err != nil {
+		return nil, err
+	}
+	quirks := set.For(program)
+
+	// --help-strategy wins over the overrides file
+	names := flagHelpStrategies
+	if len(names) == 0 && quirks != nil {
+		names = quirks.HelpStrategy
+	}
+	if len(names) == 0 && helpFlagsOnly {
+		names = batch.HelpStrategies
+	}
+	var strategies []parser.HelpStrategy
+	for _, s := range names {
+		st, err := parser.ParseHelpStrategy(s)
+		if err != nil {
+			return nil, err
+		}
+		strategies = append(strategies, st)
+	}
+	var maxDepth int
+	if quirks != nil {
+		maxDepth = quirks.MaxDepth
+	}
 
-	// Build command tree with live progress on stderr
-	progress := func(msg string) {
-		fmt.Fprintf(os.Stderr, "  ⟳  %s\n", msg)
+	var diag *parser.Diagnostics
+	if flagExplain {
+		diag = &parser.Diagnostics{}
+	}
+	if flagTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, flagTimeout)
+		defer cancel()
+	}
+	cmdTree, parseErr := parser.ParseWithOptions(ctx, program, parser.Options{
+		HelpStrategies:    strategies,
+		KeepLocale:        flagKeepLocale,
+		HelpFile:          flagHelpFile,
+		ManFile:           flagManFile,
+		NoNative:          flagNoNative,
+		Concurrency:       flagConcurrency,
+		Pool:              pool,
+		ProbeTimeout:      flagProbeTimeout,
+		MaxDepth:          maxDepth,
+		IgnoreSubcommands: quirks.IgnoredPaths(),
+		Diagnostics:       diag,
+		Progress:          progress,
+	})
+	if errors.Is(parseErr, context.Canceled) {
+		return nil, fmt.Errorf("interrupted")
+	}
+	if errors.Is(parseErr, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("parsing %q did not finish within %s", program, flagTimeout)
+	}
+	if parseErr != nil && (flagHelpFile != "" || flagManFile != "") && flagAI == "" {
+		return nil, fmt.Errorf("could not extract completions for %q: %w", program, parseErr)
 	}
-	cmdTree, parseErr := parser.ParseWithProgress(program, progress)
 	if parseErr != nil || (len(cmdTree.Flags) == 0 && len(cmdTree.Subcommands) == 0) {
 		if flagAI == "" {
-			return fmt.Errorf(
+			return nil, fmt.Errorf(
 				"could not extract completions for %q (no man page or --help output found)\n"+
 					"Tip: use --ai ollama or --ai openai to use AI as fallback", program,
 			)
@@ -84,35 +1071,262 @@ func run(cmd *cobra.Command, args []string) error {
 		fmt.Fprintf(os.Stderr, "→ No completions found via help/man, falling back to AI (%s)\n", flagAI)
 		cmdTree, err = runAI(program, sh)
 		if err != nil {
-			return fmt.Errorf("AI fallback failed: %w", err)
+			return nil, fmt.Errorf("AI fallback failed: %w", err)
 		}
 	}
 
-	// Generate completions
-	var output string
+	overrides.Apply(cmdTree, quirks)
+	// Scripts complete the command name, not the path it was given as
+	cmdTree.Name = filepath.Base(program)
+
+	if flagExplain {
+		parser.WriteReport(os.Stderr, cmdTree, diag)
+	}
+	return cmdTree, nil
+}
+
+// saveSpec stores the spec of cmdTree for runtime completion (__complete)
+// when its completions are installed. Trees read from a help or man file are
+// left out: the spec would stand for the program in PATH, which the file may
+// not describe.
+func saveSpec(cmdTree *model.Command) {
+	if origin(cmdTree) == installer.OriginHelpFile {
+		return
+	}
+	if _, err := spec.Save(cmdTree); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
+
+// origin tells how cmdTree was made, for the install manifest: empty if it
+// was parsed from the program, which refresh can do again.
+func origin(cmdTree *model.Command) string {
+	switch {
+	case cmdTree.Source == model.SourceAI:
+		return installer.OriginAI
+	case flagHelpFile != "" || flagManFile != "":
+		return installer.OriginHelpFile
+	}
+	return ""
+}
+
+// planInstall returns what installing content as the completions of
+// program would change.
+func planInstall(sh shell.Shell, program, content string) (*installer.Change, error) {
+	path, err := installer.Target(sh, installDir(sh), program)
+	if err != nil {
+		return nil, err
+	}
+	change, err := installer.Plan(path, content)
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// printChange shows what a --dry-run install would do: the target path on
+// stderr, the diff on stdout.
+func printChange(c installer.Change) {
+	switch {
+	case !c.Exists:
+		fmt.Fprintf(os.Stderr, "→ Would create %s\n", c.Path)
+	case c.Diff == "":
+		fmt.Fprintf(os.Stderr, "→ %s is up to date\n", c.Path)
+	case c.Foreign && !flagOverwrite:
+		fmt.Fprintf(os.Stderr, "→ Would refuse to replace %s: not generated by theautocompletor (use --force)\n", c.Path)
+	case c.Foreign:
+		fmt.Fprintf(os.Stderr, "→ Would back up and replace %s (not generated by theautocompletor)\n", c.Path)
+	default:
+		fmt.Fprintf(os.Stderr, "→ Would update %s\n", c.Path)
+	}
+	fmt.Print(c.Diff)
+}
+
+// verifyInstall starts a new shell to check that it loads the completions
+// just installed at path, and if it doesn't, updates its startup file
+// (--setup-rc) or prints what to add to it.
+func verifyInstall(ctx context.Context, sh shell.Shell, path, program string) {
+	dir := filepath.Dir(path)
+	res, err := rc.Check(ctx, sh, dir, program)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "! Could not verify that %s loads the completions: %v\n", sh, err)
+		return
+	}
+	if res.Loaded {
+		fmt.Fprintf(os.Stderr, "✓ Verified: new %s sessions load the completions\n", sh)
+		return
+	}
+
+	snippet, err := rc.Snippet(sh, dir, res)
+	if errors.Is(err, rc.ErrNothingToAdd) {
+		fmt.Fprintf(os.Stderr, "! %s does not load completions from %s (%s), though its startup files need no change.\n",
+			sh, dir, strings.Join(res.Reasons(sh), ", "))
+		return
+	}
+	if flagSetupRC {
+		file, err := rc.Apply(sh, snippet)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "! Could not update the %s startup file: %v\n", sh, err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "✓ Updated %s\n", file)
+		if res, err := rc.Check(ctx, sh, dir, program); err == nil && !res.Loaded {
+			fmt.Fprintf(os.Stderr, "! %s still does not load the completions (%s); check %s\n",
+				sh, strings.Join(res.Reasons(sh), ", "), file)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "  Open a new terminal (or run: exec %s) to use them.\n", sh)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "! %s does not load completions from %s yet: %s.\n", sh, dir, strings.Join(res.Reasons(sh), ", "))
+	fmt.Fprintf(os.Stderr, "  Add this to %s (or rerun with --setup-rc), then open a new terminal:\n\n", rc.File(sh))
+	for _, line := range strings.Split(strings.TrimSuffix(rc.Block(snippet), "\n"), "\n") {
+		fmt.Fprintf(os.Stderr, "    %s\n", line)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+// installDir returns the directory chosen with --dir or --system, or "" for
+// the shell's per-user directory.
+func installDir(sh shell.Shell) string {
+	if flagSystem {
+		return shell.SystemCompletionsDir(sh)
+	}
+	return flagDir
+}
+
+// stderrProgress shows the parser's steps live on stderr.
+func stderrProgress(msg string) {
+	fmt.Fprintf(os.Stderr, "  ⟳  %s\n", msg)
+}
+
+// render generates the completion script of cmdTree for sh.
+func render(sh shell.Shell, cmdTree *model.Command) string {
 	switch sh {
 	case shell.Fish:
-		output = generator.Fish(cmdTree)
+		return generator.Fish(cmdTree)
 	case shell.Bash:
-		output = generator.Bash(cmdTree)
+		return generator.Bash(cmdTree)
 	case shell.Zsh:
-		output = generator.Zsh(cmdTree)
+		return generator.Zsh(cmdTree)
 	}
+	return ""
+}
 
-	// Install or print
-	if flagInstall {
-		path, err := installer.Install(sh, program, output)
-		if err != nil {
-			return fmt.Errorf("install failed: %w", err)
+func runUninstall(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	var sh shell.Shell
+	if flagShell != "" {
+		var err error
+		if sh, err = shell.Parse(flagShell); err != nil {
+			return err
+		}
+	}
+	var errs []error
+	err := installer.UpdateManifest(func(m *installer.Manifest) {
+		for _, program := range args {
+			program = filepath.Base(program)
+			removed := m.Remove(program, sh)
+			if len(removed) == 0 {
+				errs = append(errs, fmt.Errorf("no installed completions for %q", program))
+				continue
+			}
+			for _, e := range removed {
+				if err := installer.Uninstall(e); err != nil {
+					errs = append(errs, err)
+					m.Put(e) // keep track of it
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "✓ Removed %s\n", e.Path)
+			}
+			if len(m.Find(program)) == 0 {
+				os.Remove(spec.Path(program))
+			}
+		}
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// runStatus prints every recorded detail of the installed scripts of one
+// program, or of all of them.
+func runStatus(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	m, err := installer.LoadManifest()
+	if err != nil {
+		return err
+	}
+	var program string
+	if len(args) > 0 {
+		program = filepath.Base(args[0])
+	}
+	entries := m.Find(program)
+	if len(entries) == 0 {
+		if program != "" {
+			return fmt.Errorf("no installed completions for %q", program)
+		}
+		fmt.Fprintln(os.Stderr, "No completions installed.")
+		return nil
+	}
+	for i, e := range entries {
+		if i > 0 {
+			fmt.Println()
+		}
+		status := e.Check()
+		fmt.Printf("%s (%s): %s\n", e.Program, e.Shell, status)
+		fmt.Printf("  script:     %s\n", e.Path)
+		if e.Binary != "" {
+			fmt.Printf("  binary:     %s\n", e.Binary)
+			fmt.Printf("  sha256:     %s\n", e.BinaryHash)
+		}
+		if e.Origin != "" {
+			fmt.Printf("  made from:  %s (not refreshable)\n", e.Origin)
+		}
+		fmt.Printf("  installed:  %s by theautocompletor %s\n", e.InstalledAt.Local().Format(time.DateTime), e.Version)
+		switch status {
+		case installer.StatusOutdated, installer.StatusMissing:
+			fmt.Printf("  reinstall:  theautocompletor install %s --shell %s\n", e.Program, e.Shell)
+		case installer.StatusOrphaned:
+			fmt.Printf("  remove:     theautocompletor uninstall %s --shell %s\n", e.Program, e.Shell)
 		}
-		fmt.Fprintf(os.Stderr, "✓ Completions installed to %s\n", path)
-	} else {
-		fmt.Print(output)
 	}
+	return nil
+}
 
+// runDoctor prints the doctor report and fails if it found problems.
+func runDoctor(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	switch flagAI {
+	case "", "ollama", "openai":
+	default:
+		return fmt.Errorf("unknown AI backend %q (use ollama or openai)", flagAI)
+	}
+	opts := doctor.Options{AI: flagAI, APIKey: flagAPIKey, Model: flagModel}
+	if len(args) > 0 {
+		opts.Program = args[0]
+	}
+	report := doctor.Run(cmd.Context(), opts)
+	report.Write(os.Stdout)
+	if n := report.Problems(); n > 0 {
+		return fmt.Errorf("%d problem(s) found", n)
+	}
 	return nil
 }
 
+// buildVersion returns the version recorded in the install manifest.
+func buildVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return version
+}
+
 func runAI(program string, sh shell.Shell) (*model.Command, error) {
 	switch flagAI {
 	case "ollama":
@@ -124,13 +1338,38 @@ func runAI(program string, sh shell.Shell) (*model.Command, error) {
 	}
 }
 
+// runComplete answers a runtime completion request from a generated script:
+// "__complete <program> <words...>", where the last word is the one being
+// completed. It prints nothing if no spec is stored for the program.
+func runComplete(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		return
+	}
+	cmdTree, err := spec.Load(args[0])
+	if err != nil {
+		return
+	}
+	complete.Write(os.Stdout, complete.Complete(ctx, cmdTree, args[1:]))
+}
+
 func main() {
 	// Register "tac" alias only if the system tac command is not present
 	if _, err := exec.LookPath("tac"); err != nil {
 		os.Args[0] = "tac" // cosmetic only; cobra uses Use field
 	}
 
-	if err := rootCmd.Execute(); err != nil {
+	// Ctrl-C cancels the parse and kills running probes.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Runtime completion bypasses cobra so the completed words are never
+	// parsed as our own flags (cobra also reserves the name for itself).
+	if len(os.Args) > 1 && os.Args[1] == "__complete" {
+		runComplete(ctx, os.Args[2:])
+		return
+	}
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 		os.Exit(1)
 	}